@@ -0,0 +1,498 @@
+package vlfeat
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"sync"
+)
+
+var oneVsRestMagic = [4]byte{'V', 'L', 'O', 'R'}
+
+// OneVsRestOptions configure the Svm of every class. Zero values mean the SDCA
+// solver, the hinge loss, lambda 1e-4, bias multiplier 1, the vl_svm defaults for
+// MaxNumIterations and Epsilon, and one worker. BalanceClasses weights the positives
+// and the negatives of a class so that they have the same total weight.
+type OneVsRestOptions struct {
+	Solver           VlSvmSolverType
+	Loss             VlSvmLossType
+	Lambda           float64
+	BiasMultiplier   float64
+	MaxNumIterations uint
+	Epsilon          float64
+	BalanceClasses   bool
+	NumWorkers       int
+	Diagnostic       func(class int, stats SvmStatistics)
+}
+
+// PlattCalibration maps a score s to the probability 1 / (1 + exp(A s + B))
+type PlattCalibration struct {
+	A float64 `json:"a"`
+	B float64 `json:"b"`
+}
+
+func (calibration PlattCalibration) Probability(score float64) float64 {
+	return 1 / (1 + math.Exp(calibration.A*score+calibration.B))
+}
+
+// OneVsRestClassifier is a set of linear classifiers, one per class against the
+// others, trained on encodings such as the output of FisherEncode or VladEncode.
+type OneVsRestClassifier struct {
+	Version      int                `json:"version"`
+	NumClasses   uint               `json:"numClasses"`
+	Dimension    uint               `json:"dimension"`
+	Weights      [][]float64        `json:"weights"`
+	Biases       []float64          `json:"biases"`
+	Calibrations []PlattCalibration `json:"calibrations"`
+	// statistics of the last Train, not saved
+	Statistics []SvmStatistics `json:"-"`
+}
+
+/* Training */
+
+// TrainOneVsRest trains numClasses classifiers on numData data of the given dimension,
+// stored row by row, with labels in [0, numClasses). The classes are trained in
+// parallel by NumWorkers workers. Calibrations are set to 1 / (1 + exp(-s)) until
+// Calibrate is called.
+func TrainOneVsRest(data []float64, dimension, numData uint, labels []int, numClasses uint, options OneVsRestOptions) (OneVsRestClassifier, error) {
+	if dimension == 0 || numData == 0 || numClasses == 0 {
+		return OneVsRestClassifier{}, errors.New("dimension, numData and numClasses must be positive")
+	}
+	if len(data) < int(dimension*numData) || len(labels) < int(numData) {
+		return OneVsRestClassifier{}, errors.New("data must hold numData x dimension values and labels numData values")
+	}
+	for _, label := range labels[:numData] {
+		if label < 0 || label >= int(numClasses) {
+			return OneVsRestClassifier{}, errors.New("label out of range")
+		}
+	}
+	if options.Solver == VlSvmSolverNone {
+		options.Solver = VlSvmSolverSdca
+	}
+	if options.Lambda == 0 {
+		options.Lambda = 1e-4
+	}
+	if options.BiasMultiplier == 0 {
+		options.BiasMultiplier = 1
+	}
+	if options.NumWorkers <= 0 {
+		options.NumWorkers = 1
+	}
+
+	// the data is copied to C memory once and shared by the classes
+	svmData, err := NewSvmData(data, dimension, numData)
+	if err != nil {
+		return OneVsRestClassifier{}, err
+	}
+	defer svmData.Delete()
+
+	classifier := OneVsRestClassifier{
+		Version:      ModelVersion,
+		NumClasses:   numClasses,
+		Dimension:    dimension,
+		Weights:      make([][]float64, numClasses),
+		Biases:       make([]float64, numClasses),
+		Calibrations: make([]PlattCalibration, numClasses),
+		Statistics:   make([]SvmStatistics, numClasses),
+	}
+	classes := make(chan int)
+	errs := make([]error, numClasses)
+	var wg sync.WaitGroup
+	for w := 0; w < options.NumWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for class := range classes {
+				errs[class] = classifier.trainClass(class, &svmData, labels, options)
+			}
+		}()
+	}
+	for class := 0; class < int(numClasses); class++ {
+		classes <- class
+	}
+	close(classes)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return OneVsRestClassifier{}, err
+		}
+	}
+	return classifier, nil
+}
+
+func (classifier *OneVsRestClassifier) trainClass(class int, data *SvmData, labels []int, options OneVsRestOptions) error {
+	numData := data.numData
+	binaryLabels := make([]float64, numData)
+	numPositives := 0
+	for i, label := range labels[:numData] {
+		if label == class {
+			binaryLabels[i] = 1
+			numPositives++
+		} else {
+			binaryLabels[i] = -1
+		}
+	}
+	svm, err := NewSvmFromData(options.Solver, data, binaryLabels, options.Lambda)
+	if err != nil {
+		return err
+	}
+	defer svm.Delete()
+	svm.SetLoss(options.Loss)
+	svm.SetBiasMultiplier(options.BiasMultiplier)
+	if options.MaxNumIterations > 0 {
+		svm.SetMaxNumIterations(options.MaxNumIterations)
+	}
+	if options.Epsilon > 0 {
+		svm.SetEpsilon(options.Epsilon)
+	}
+	if options.BalanceClasses && numPositives > 0 && numPositives < int(numData) {
+		weights := make([]float64, numData)
+		for i, y := range binaryLabels {
+			if y > 0 {
+				weights[i] = float64(numData) / (2 * float64(numPositives))
+			} else {
+				weights[i] = float64(numData) / (2 * float64(int(numData)-numPositives))
+			}
+		}
+		if err := svm.SetWeights(weights); err != nil {
+			return err
+		}
+	}
+	if options.Diagnostic != nil {
+		svm.SetDiagnosticFunction(func(stats SvmStatistics) {
+			options.Diagnostic(class, stats)
+		})
+	}
+	classifier.Statistics[class] = svm.Train()
+	classifier.Weights[class] = svm.GetModel()
+	classifier.Biases[class] = svm.GetBias()
+	classifier.Calibrations[class] = PlattCalibration{A: -1}
+	return nil
+}
+
+/* Calibration */
+
+// fitPlatt fits A and B by Newton's method on the regularized targets of Platt (1999)
+func fitPlatt(scores []float64, positives []bool) PlattCalibration {
+	numPositives, numNegatives := 0.0, 0.0
+	for _, p := range positives {
+		if p {
+			numPositives++
+		} else {
+			numNegatives++
+		}
+	}
+	hi := (numPositives + 1) / (numPositives + 2)
+	lo := 1 / (numNegatives + 2)
+	targets := make([]float64, len(scores))
+	for i, p := range positives {
+		if p {
+			targets[i] = hi
+		} else {
+			targets[i] = lo
+		}
+	}
+	A, B := 0.0, math.Log((numNegatives+1)/(numPositives+1))
+	for iteration := 0; iteration < 100; iteration++ {
+		// gradient and Hessian of the cross entropy
+		gA, gB := 0.0, 0.0
+		hAA, hAB, hBB := 1e-12, 0.0, 1e-12
+		for i, s := range scores {
+			p := 1 / (1 + math.Exp(A*s+B))
+			d := targets[i] - p
+			gA += d * s
+			gB += d
+			w := p * (1 - p)
+			hAA += w * s * s
+			hAB += w * s
+			hBB += w
+		}
+		det := hAA*hBB - hAB*hAB
+		if det == 0 {
+			break
+		}
+		dA := -(hBB*gA - hAB*gB) / det
+		dB := -(-hAB*gA + hAA*gB) / det
+		A += dA
+		B += dB
+		if math.Abs(dA) < 1e-10 && math.Abs(dB) < 1e-10 {
+			break
+		}
+	}
+	return PlattCalibration{A: A, B: B}
+}
+
+// Calibrate fits the Platt calibration of every class on held out data and labels.
+func (classifier *OneVsRestClassifier) Calibrate(data []float64, numData uint, labels []int) error {
+	if len(labels) < int(numData) {
+		return errors.New("labels must hold numData values")
+	}
+	scores, err := classifier.Scores(data, numData)
+	if err != nil {
+		return err
+	}
+	classScores := make([]float64, numData)
+	positives := make([]bool, numData)
+	for class := range classifier.Calibrations {
+		for i := range classScores {
+			classScores[i] = scores[i][class]
+			positives[i] = labels[i] == class
+		}
+		classifier.Calibrations[class] = fitPlatt(classScores, positives)
+	}
+	return nil
+}
+
+/* Prediction */
+
+// Scores returns the numData x NumClasses scores w x + b
+func (classifier *OneVsRestClassifier) Scores(data []float64, numData uint) ([][]float64, error) {
+	D := int(classifier.Dimension)
+	if len(data) < int(numData)*D {
+		return nil, errors.New("data must hold numData x dimension values")
+	}
+	scores := make([][]float64, numData)
+	for i := range scores {
+		x := data[i*D : (i+1)*D]
+		scores[i] = make([]float64, classifier.NumClasses)
+		for class, w := range classifier.Weights {
+			score := classifier.Biases[class]
+			for j, v := range w {
+				score += v * x[j]
+			}
+			scores[i][class] = score
+		}
+	}
+	return scores, nil
+}
+
+// Probabilities returns the calibrated numData x NumClasses probabilities
+func (classifier *OneVsRestClassifier) Probabilities(data []float64, numData uint) ([][]float64, error) {
+	scores, err := classifier.Scores(data, numData)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range scores {
+		for class, score := range row {
+			row[class] = classifier.Calibrations[class].Probability(score)
+		}
+	}
+	return scores, nil
+}
+
+// Predict returns the class with the highest calibrated probability for every datum
+func (classifier *OneVsRestClassifier) Predict(data []float64, numData uint) ([]int, error) {
+	topK, err := classifier.PredictTopK(data, numData, 1)
+	if err != nil {
+		return nil, err
+	}
+	predicted := make([]int, numData)
+	for i, classes := range topK {
+		predicted[i] = classes[0]
+	}
+	return predicted, nil
+}
+
+// PredictTopK returns the k classes with the highest calibrated probabilities for
+// every datum, best first
+func (classifier *OneVsRestClassifier) PredictTopK(data []float64, numData uint, k int) ([][]int, error) {
+	probabilities, err := classifier.Probabilities(data, numData)
+	if err != nil {
+		return nil, err
+	}
+	topK := make([][]int, numData)
+	for i, row := range probabilities {
+		topK[i] = rankClasses(row, k)
+	}
+	return topK, nil
+}
+
+// rankClasses returns the indices of the k highest values, all of them when k <= 0
+func rankClasses(values []float64, k int) []int {
+	classes := make([]int, len(values))
+	for i := range classes {
+		classes[i] = i
+	}
+	sort.SliceStable(classes, func(i, j int) bool { return values[classes[i]] > values[classes[j]] })
+	if k > 0 && k < len(classes) {
+		classes = classes[:k]
+	}
+	return classes
+}
+
+/* Metrics */
+
+// AveragePrecision is the area under the precision-recall curve of the scores, as
+// vl_pr computes it: the mean of the precisions at the ranks of the positives.
+func AveragePrecision(scores []float64, positives []bool) float64 {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	numPositives := 0
+	for _, p := range positives {
+		if p {
+			numPositives++
+		}
+	}
+	if numPositives == 0 {
+		return 0
+	}
+	ap := 0.0
+	truePositives := 0
+	for rank, i := range order {
+		if positives[i] {
+			truePositives++
+			ap += float64(truePositives) / float64(rank+1)
+		}
+	}
+	return ap / float64(numPositives)
+}
+
+// MeanAveragePrecision returns the average precision of every class on numData x
+// numClasses scores and their mean over the classes having positives
+func MeanAveragePrecision(scores [][]float64, labels []int, numClasses uint) ([]float64, float64) {
+	aps := make([]float64, numClasses)
+	classScores := make([]float64, len(scores))
+	positives := make([]bool, len(scores))
+	sum, numValid := 0.0, 0
+	for class := 0; class < int(numClasses); class++ {
+		hasPositive := false
+		for i, row := range scores {
+			classScores[i] = row[class]
+			positives[i] = labels[i] == class
+			hasPositive = hasPositive || positives[i]
+		}
+		aps[class] = AveragePrecision(classScores, positives)
+		if hasPositive {
+			sum += aps[class]
+			numValid++
+		}
+	}
+	if numValid == 0 {
+		return aps, 0
+	}
+	return aps, sum / float64(numValid)
+}
+
+// ConfusionMatrix returns the numClasses x numClasses counts, rows are the true labels
+// and columns the predicted ones
+func ConfusionMatrix(predicted, labels []int, numClasses uint) [][]int {
+	matrix := make([][]int, numClasses)
+	for i := range matrix {
+		matrix[i] = make([]int, numClasses)
+	}
+	for i, label := range labels {
+		if label >= 0 && label < int(numClasses) && predicted[i] >= 0 && predicted[i] < int(numClasses) {
+			matrix[label][predicted[i]]++
+		}
+	}
+	return matrix
+}
+
+// TopKAccuracy is the fraction of data whose label is among its k best scored classes
+func TopKAccuracy(scores [][]float64, labels []int, k int) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+	correct := 0
+	for i, row := range scores {
+		for _, class := range rankClasses(row, k) {
+			if class == labels[i] {
+				correct++
+				break
+			}
+		}
+	}
+	return float64(correct) / float64(len(scores))
+}
+
+/* Save and load */
+
+func (classifier *OneVsRestClassifier) check() error {
+	if classifier.Version != ModelVersion {
+		return errors.New("unsupported classifier version")
+	}
+	n := int(classifier.NumClasses)
+	if len(classifier.Weights) != n || len(classifier.Biases) != n || len(classifier.Calibrations) != n {
+		return errors.New("classifier parameters have the wrong length")
+	}
+	for _, w := range classifier.Weights {
+		if len(w) != int(classifier.Dimension) {
+			return errors.New("classifier weights have the wrong length")
+		}
+	}
+	return nil
+}
+
+// Save writes the classifier in the binary model format: the header, then for every
+// class its weights, bias and calibration.
+func (classifier *OneVsRestClassifier) Save(w io.Writer) error {
+	if err := classifier.check(); err != nil {
+		return err
+	}
+	header := []uint32{
+		uint32(classifier.Version),
+		uint32(classifier.NumClasses),
+		uint32(classifier.Dimension),
+	}
+	if err := binary.Write(w, binary.LittleEndian, oneVsRestMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	for class, weights := range classifier.Weights {
+		calibration := classifier.Calibrations[class]
+		values := append(append([]float64{}, weights...), classifier.Biases[class], calibration.A, calibration.B)
+		if err := writeModelValues(w, VlTypeDouble, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadOneVsRestClassifier reads a classifier written by Save.
+func LoadOneVsRestClassifier(r io.Reader) (OneVsRestClassifier, error) {
+	header := make([]uint32, 3)
+	if err := readModelHeader(r, oneVsRestMagic, header); err != nil {
+		return OneVsRestClassifier{}, err
+	}
+	classifier := OneVsRestClassifier{
+		Version:    int(header[0]),
+		NumClasses: uint(header[1]),
+		Dimension:  uint(header[2]),
+	}
+	if classifier.Version != ModelVersion {
+		return OneVsRestClassifier{}, errors.New("unsupported classifier version")
+	}
+	D := int(classifier.Dimension)
+	for class := 0; class < int(classifier.NumClasses); class++ {
+		values, err := readModelValues(r, VlTypeDouble, D+3)
+		if err != nil {
+			return OneVsRestClassifier{}, err
+		}
+		classifier.Weights = append(classifier.Weights, values[:D])
+		classifier.Biases = append(classifier.Biases, values[D])
+		classifier.Calibrations = append(classifier.Calibrations, PlattCalibration{A: values[D+1], B: values[D+2]})
+	}
+	return classifier, classifier.check()
+}
+
+// SaveJSON writes the classifier as JSON.
+func (classifier *OneVsRestClassifier) SaveJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(classifier)
+}
+
+// LoadOneVsRestClassifierJSON reads a classifier written by SaveJSON.
+func LoadOneVsRestClassifierJSON(r io.Reader) (OneVsRestClassifier, error) {
+	var classifier OneVsRestClassifier
+	if err := json.NewDecoder(r).Decode(&classifier); err != nil {
+		return OneVsRestClassifier{}, err
+	}
+	return classifier, classifier.check()
+}
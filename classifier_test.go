@@ -0,0 +1,144 @@
+package vlfeat
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestFitPlatt(t *testing.T) {
+	// labels drawn from the calibration A = -2, B = 0.5
+	random := rand.New(rand.NewSource(1))
+	scores := make([]float64, 20000)
+	positives := make([]bool, len(scores))
+	for i := range scores {
+		scores[i] = 4*random.Float64() - 2
+		positives[i] = random.Float64() < PlattCalibration{A: -2, B: 0.5}.Probability(scores[i])
+	}
+	calibration := fitPlatt(scores, positives)
+	if math.Abs(calibration.A+2) > 0.1 || math.Abs(calibration.B-0.5) > 0.1 {
+		t.Errorf("calibration = %+v, want A = -2 and B = 0.5", calibration)
+	}
+	// at the optimum the probabilities sum to the regularized targets
+	numPositives := 0.0
+	sum := 0.0
+	for i, s := range scores {
+		sum += calibration.Probability(s)
+		if positives[i] {
+			numPositives++
+		}
+	}
+	numNegatives := float64(len(scores)) - numPositives
+	want := numPositives*(numPositives+1)/(numPositives+2) + numNegatives/(numNegatives+2)
+	if math.Abs(sum-want) > 1e-6 {
+		t.Errorf("probabilities sum to %g, want %g", sum, want)
+	}
+}
+
+func TestClassificationMetrics(t *testing.T) {
+	// positives at ranks 1 and 3
+	ap := AveragePrecision([]float64{0.9, 0.1, 0.5, 0.7}, []bool{true, false, true, false})
+	if math.Abs(ap-(1+2.0/3)/2) > 1e-12 {
+		t.Errorf("average precision %g, want %g", ap, (1+2.0/3)/2)
+	}
+	if ap := AveragePrecision([]float64{1, 2}, []bool{false, false}); ap != 0 {
+		t.Errorf("average precision without positives %g, want 0", ap)
+	}
+
+	scores := [][]float64{{0.9, 0.1, 0.5}, {0.2, 0.3, 0.1}, {0.1, 0.8, 0.6}, {0.3, 0.2, 0.4}}
+	labels := []int{0, 0, 1, 0}
+	aps, mean := MeanAveragePrecision(scores, labels, 3)
+	if aps[2] != 0 || math.Abs(mean-(aps[0]+aps[1])/2) > 1e-12 {
+		t.Errorf("aps %v with mean %g, class 2 has no positives", aps, mean)
+	}
+	if accuracy := TopKAccuracy(scores, labels, 1); accuracy != 0.5 {
+		t.Errorf("top 1 accuracy %g, want 0.5", accuracy)
+	}
+	if accuracy := TopKAccuracy(scores, labels, 2); accuracy != 1 {
+		t.Errorf("top 2 accuracy %g, want 1", accuracy)
+	}
+	matrix := ConfusionMatrix([]int{0, 1, 1, 2, -1}, []int{0, 2, 1, 0, 1}, 3)
+	if !reflect.DeepEqual(matrix, [][]int{{1, 0, 1}, {0, 1, 0}, {0, 1, 0}}) {
+		t.Errorf("confusion matrix %v", matrix)
+	}
+}
+
+// newTestClassifier classifies 2D points by their largest coordinate among x, y and -x-y
+func newTestClassifier() OneVsRestClassifier {
+	return OneVsRestClassifier{
+		Version:      ModelVersion,
+		NumClasses:   3,
+		Dimension:    2,
+		Weights:      [][]float64{{1, 0}, {0, 1}, {-1, -1}},
+		Biases:       []float64{0, 0, 0},
+		Calibrations: []PlattCalibration{{A: -1}, {A: -1}, {A: -1}},
+	}
+}
+
+func TestOneVsRestPredict(t *testing.T) {
+	classifier := newTestClassifier()
+	data := []float64{2, 0, 0, 3, -1, -1, 1, 0.5}
+	predicted, err := classifier.Predict(data, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(predicted, []int{0, 1, 2, 0}) {
+		t.Errorf("predicted %v, want [0 1 2 0]", predicted)
+	}
+	topK, _ := classifier.PredictTopK(data, 4, 2)
+	if !reflect.DeepEqual(topK[3], []int{0, 1}) {
+		t.Errorf("top 2 of (1, 0.5) = %v, want [0 1]", topK[3])
+	}
+
+	// calibrations fitted on held out data increase with the score of their class
+	random := rand.New(rand.NewSource(1))
+	held := make([]float64, 2*300)
+	labels := make([]int, 300)
+	for i := range labels {
+		labels[i] = i % 3
+		center := [][2]float64{{2, 0}, {0, 2}, {-2, -2}}[labels[i]]
+		held[2*i] = center[0] + random.NormFloat64()
+		held[2*i+1] = center[1] + random.NormFloat64()
+	}
+	if err := classifier.Calibrate(held, 300, labels); err != nil {
+		t.Fatal(err)
+	}
+	for class, calibration := range classifier.Calibrations {
+		if calibration.A >= 0 {
+			t.Errorf("class %d: calibration %+v decreases with the score", class, calibration)
+		}
+	}
+	if _, err := classifier.Scores(data, 5); err == nil {
+		t.Error("Scores accepted 4 data as 5")
+	}
+}
+
+func TestOneVsRestSaveLoad(t *testing.T) {
+	classifier := newTestClassifier()
+	classifier.Calibrations[1] = PlattCalibration{A: -0.5, B: 0.25}
+	var buffer bytes.Buffer
+	if err := classifier.Save(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadOneVsRestClassifier(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, classifier) {
+		t.Errorf("loaded %+v, want %+v", loaded, classifier)
+	}
+
+	buffer.Reset()
+	classifier.SaveJSON(&buffer)
+	loaded, err = LoadOneVsRestClassifierJSON(&buffer)
+	if err != nil || !reflect.DeepEqual(loaded, classifier) {
+		t.Errorf("loaded %+v from JSON, error %v", loaded, err)
+	}
+
+	classifier.Weights[2] = []float64{1}
+	if err := classifier.Save(&buffer); err == nil {
+		t.Error("Save accepted weights of the wrong dimension")
+	}
+}
@@ -58,72 +58,130 @@ func ToCVlTypeArrayPtr(data interface{}, vlType VlType) (unsafe.Pointer, int, er
 	case reflect.Slice, reflect.Array:
 		slice := reflect.ValueOf(data)
 		length := slice.Len()
+		if length == 0 {
+			return nil, 0, errors.New("slice or array must not be empty")
+		}
 		switch vlType {
 		case VlTypeFloat:
 			cData := make([]C.float, length)
 			for i := 0; i < length; i++ {
 				cData[i] = C.float(slice.Index(i).Float())
 			}
-			return unsafe.Pointer(&cData), length, nil
+			return unsafe.Pointer(&cData[0]), length, nil
 		case VlTypeDouble:
 			cData := make([]C.double, length)
 			for i := 0; i < length; i++ {
 				cData[i] = C.double(slice.Index(i).Float())
 			}
-			return unsafe.Pointer(&cData), length, nil
+			return unsafe.Pointer(&cData[0]), length, nil
 		case VlTypeInt8:
 			cData := make([]C.char, length)
 			for i := 0; i < length; i++ {
 				cData[i] = C.char(slice.Index(i).Int())
 			}
-			return unsafe.Pointer(&cData), length, nil
+			return unsafe.Pointer(&cData[0]), length, nil
 		case VlTypeUint8:
 			cData := make([]C.uchar, length)
 			for i := 0; i < length; i++ {
 				cData[i] = C.uchar(slice.Index(i).Int())
 			}
-			return unsafe.Pointer(&cData), length, nil
+			return unsafe.Pointer(&cData[0]), length, nil
 		case VlTypeInt16:
 			cData := make([]C.short, length)
 			for i := 0; i < length; i++ {
 				cData[i] = C.short(slice.Index(i).Int())
 			}
-			return unsafe.Pointer(&cData), length, nil
+			return unsafe.Pointer(&cData[0]), length, nil
 		case VlTypeUint16:
 			cData := make([]C.ushort, length)
 			for i := 0; i < length; i++ {
 				cData[i] = C.ushort(slice.Index(i).Int())
 			}
-			return unsafe.Pointer(&cData), length, nil
+			return unsafe.Pointer(&cData[0]), length, nil
 		case VlTypeInt32:
 			cData := make([]C.int, length)
 			for i := 0; i < length; i++ {
 				cData[i] = C.int(slice.Index(i).Int())
 			}
-			return unsafe.Pointer(&cData), length, nil
+			return unsafe.Pointer(&cData[0]), length, nil
 		case VlTypeUint32:
 			cData := make([]C.uint, length)
 			for i := 0; i < length; i++ {
 				cData[i] = C.uint(slice.Index(i).Int())
 			}
-			return unsafe.Pointer(&cData), length, nil
+			return unsafe.Pointer(&cData[0]), length, nil
 		case VlTypeInt64:
 			cData := make([]C.longlong, length)
 			for i := 0; i < length; i++ {
 				cData[i] = C.longlong(slice.Index(i).Int())
 			}
-			return unsafe.Pointer(&cData), length, nil
+			return unsafe.Pointer(&cData[0]), length, nil
 		case VlTypeUint64:
 			cData := make([]C.ulonglong, length)
 			for i := 0; i < length; i++ {
 				cData[i] = C.ulonglong(slice.Index(i).Int())
 			}
-			return unsafe.Pointer(&cData), length, nil
+			return unsafe.Pointer(&cData[0]), length, nil
 		}
 	}
 	return nil, 0, errors.New("must be support slice or array")
 }
 
+// convert a go slice or array of numbers to []float64
+func toFloat64Slice(data interface{}) ([]float64, error) {
+	switch d := data.(type) {
+	case []float64:
+		return d, nil
+	case []float32:
+		values := make([]float64, len(d))
+		for i, v := range d {
+			values[i] = float64(v)
+		}
+		return values, nil
+	}
+	switch reflect.TypeOf(data).Kind() {
+	case reflect.Slice, reflect.Array:
+		slice := reflect.ValueOf(data)
+		values := make([]float64, slice.Len())
+		for i := range values {
+			v := slice.Index(i)
+			switch v.Kind() {
+			case reflect.Float32, reflect.Float64:
+				values[i] = v.Float()
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				values[i] = float64(v.Int())
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				values[i] = float64(v.Uint())
+			default:
+				return nil, errors.New("must be slice or array of numbers")
+			}
+		}
+		return values, nil
+	}
+	return nil, errors.New("must be support slice or array")
+}
+
+// copy a C float or double array to go
+func fromCVlTypeArrayPtr(ptr unsafe.Pointer, vlType VlType, length int) []float64 {
+	data := make([]float64, length)
+	if ptr == nil || length == 0 {
+		return data
+	}
+	switch vlType {
+	case VlTypeFloat:
+		cData := (*[1 << 30]C.float)(ptr)[:length:length]
+		for i, d := range cData {
+			data[i] = float64(d)
+		}
+	case VlTypeDouble:
+		cData := (*[1 << 30]C.double)(ptr)[:length:length]
+		for i, d := range cData {
+			data[i] = float64(d)
+		}
+	}
+	return data
+}
+
 type VlVectorComparisonType int
 
 const (
@@ -0,0 +1,182 @@
+package vlfeat
+
+import (
+	"errors"
+	"math"
+)
+
+// DescriptorTransform modifies in place a matrix of descriptors of the given
+// dimension, stored row by row as returned by Dsift.GetDescriptors or by appending
+// the output of Sift.CalcKeypointDescriptor.
+type DescriptorTransform func(descriptors []float32, dimension uint) error
+
+func checkDescriptors(descriptors []float32, dimension uint) error {
+	if dimension == 0 || len(descriptors)%int(dimension) != 0 {
+		return errors.New("descriptors must hold a whole number of rows of dimension values")
+	}
+	return nil
+}
+
+// ChainDescriptorTransforms returns the transform applying transforms in order
+func ChainDescriptorTransforms(transforms ...DescriptorTransform) DescriptorTransform {
+	return func(descriptors []float32, dimension uint) error {
+		for _, transform := range transforms {
+			if err := transform(descriptors, dimension); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// ApplyDescriptorTransforms applies transforms in order to the descriptors
+func ApplyDescriptorTransforms(descriptors []float32, dimension uint, transforms ...DescriptorTransform) error {
+	return ChainDescriptorTransforms(transforms...)(descriptors, dimension)
+}
+
+/* Transforms */
+
+// DescriptorL1Normalize divides every descriptor by its L1 norm, null descriptors
+// are kept
+func DescriptorL1Normalize(descriptors []float32, dimension uint) error {
+	if err := checkDescriptors(descriptors, dimension); err != nil {
+		return err
+	}
+	d := int(dimension)
+	for i := 0; i < len(descriptors); i += d {
+		row := descriptors[i : i+d : i+d]
+		var sum float32
+		for _, v := range row {
+			if v < 0 {
+				sum -= v
+			} else {
+				sum += v
+			}
+		}
+		if sum == 0 {
+			continue
+		}
+		scale := 1 / sum
+		for j := range row {
+			row[j] *= scale
+		}
+	}
+	return nil
+}
+
+// DescriptorL2Normalize divides every descriptor by its L2 norm, null descriptors
+// are kept
+func DescriptorL2Normalize(descriptors []float32, dimension uint) error {
+	if err := checkDescriptors(descriptors, dimension); err != nil {
+		return err
+	}
+	d := int(dimension)
+	for i := 0; i < len(descriptors); i += d {
+		row := descriptors[i : i+d : i+d]
+		var sum float32
+		for _, v := range row {
+			sum += v * v
+		}
+		if sum == 0 {
+			continue
+		}
+		scale := float32(1 / math.Sqrt(float64(sum)))
+		for j := range row {
+			row[j] *= scale
+		}
+	}
+	return nil
+}
+
+// DescriptorSquareRoot replaces every value v by sign(v) sqrt(|v|)
+func DescriptorSquareRoot(descriptors []float32, dimension uint) error {
+	if err := checkDescriptors(descriptors, dimension); err != nil {
+		return err
+	}
+	for j, v := range descriptors {
+		if v < 0 {
+			descriptors[j] = -float32(math.Sqrt(float64(-v)))
+		} else {
+			descriptors[j] = float32(math.Sqrt(float64(v)))
+		}
+	}
+	return nil
+}
+
+// RootSIFT maps SIFT descriptors to RootSIFT (Arandjelovic and Zisserman 2012),
+// L1 normalization followed by DescriptorSquareRoot. The results have unit L2 norm,
+// so that the Euclidean distance between them is the Hellinger kernel distance.
+func RootSIFT(descriptors []float32, dimension uint) error {
+	return ApplyDescriptorTransforms(descriptors, dimension, DescriptorL1Normalize, DescriptorSquareRoot)
+}
+
+// DescriptorClip returns the transform limiting every value to [-threshold, threshold],
+// as SIFT clips its normalized descriptors at 0.2 before normalizing them again.
+func DescriptorClip(threshold float32) DescriptorTransform {
+	return func(descriptors []float32, dimension uint) error {
+		if err := checkDescriptors(descriptors, dimension); err != nil {
+			return err
+		}
+		for j, v := range descriptors {
+			if v > threshold {
+				descriptors[j] = threshold
+			} else if v < -threshold {
+				descriptors[j] = -threshold
+			}
+		}
+		return nil
+	}
+}
+
+// DescriptorScale returns the transform multiplying every value by factor
+func DescriptorScale(factor float32) DescriptorTransform {
+	return func(descriptors []float32, dimension uint) error {
+		if err := checkDescriptors(descriptors, dimension); err != nil {
+			return err
+		}
+		for j := range descriptors {
+			descriptors[j] *= factor
+		}
+		return nil
+	}
+}
+
+/* Quantization */
+
+// QuantizeUint8 returns the descriptors as bytes, min(scale * v, 255) rounded down and
+// 0 for negative values. VLFeat stores its normalized SIFT descriptors with scale 512,
+// the bytes are then suited to IKM, HIKM and TrainIKMStream.
+func QuantizeUint8(descriptors []float32, dimension uint, scale float32) ([]uint8, error) {
+	if err := checkDescriptors(descriptors, dimension); err != nil {
+		return nil, err
+	}
+	quantized := make([]uint8, len(descriptors))
+	for j, v := range descriptors {
+		v *= scale
+		switch {
+		case v <= 0:
+			quantized[j] = 0
+		case v >= 255:
+			quantized[j] = 255
+		default:
+			quantized[j] = uint8(v)
+		}
+	}
+	return quantized, nil
+}
+
+// DequantizeUint8 maps bytes written by QuantizeUint8 back to values, v / scale
+func DequantizeUint8(quantized []uint8, dimension uint, scale float32) ([]float32, error) {
+	if dimension == 0 || len(quantized)%int(dimension) != 0 {
+		return nil, errors.New("descriptors must hold a whole number of rows of dimension values")
+	}
+	if scale == 0 {
+		return nil, errors.New("scale must not be 0")
+	}
+	descriptors := make([]float32, len(quantized))
+	inverse := 1 / scale
+	for j, v := range quantized {
+		descriptors[j] = float32(v) * inverse
+	}
+	return descriptors, nil
+}
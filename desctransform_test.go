@@ -0,0 +1,83 @@
+package vlfeat
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRootSIFT(t *testing.T) {
+	descriptors := []float32{1, 3, 0, 4, 0, 0, 0, 0, 2, 0, 2, 0}
+	if err := RootSIFT(descriptors, 4); err != nil {
+		t.Fatal(err)
+	}
+	want := []float32{float32(math.Sqrt(0.125)), float32(math.Sqrt(0.375)), 0, float32(math.Sqrt(0.5)), 0, 0, 0, 0, float32(math.Sqrt(0.5)), 0, float32(math.Sqrt(0.5)), 0}
+	for j := range want {
+		if math.Abs(float64(descriptors[j]-want[j])) > 1e-6 {
+			t.Fatalf("descriptors = %v, want %v", descriptors, want)
+		}
+	}
+	// rows have unit L2 norm, except the null one
+	for i, wantNorm := range []float64{1, 0, 1} {
+		norm := 0.0
+		for _, v := range descriptors[4*i : 4*i+4] {
+			norm += float64(v * v)
+		}
+		if math.Abs(norm-wantNorm) > 1e-6 {
+			t.Errorf("row %d has squared norm %g, want %g", i, norm, wantNorm)
+		}
+	}
+}
+
+func TestDescriptorTransformsSigns(t *testing.T) {
+	descriptors := []float32{-3, 4, 0.5, -0.1}
+	if err := ApplyDescriptorTransforms(descriptors, 2, DescriptorL2Normalize, DescriptorClip(0.7), DescriptorScale(2)); err != nil {
+		t.Fatal(err)
+	}
+	// the rows normalize to (-0.6, 0.8) and (0.98, -0.196) before clipping
+	want := []float32{-1.2, 1.4, 1.4, -0.2 / float32(math.Sqrt(0.26))}
+	for j := range want {
+		if math.Abs(float64(descriptors[j]-want[j])) > 1e-5 {
+			t.Fatalf("descriptors = %v, want %v", descriptors, want)
+		}
+	}
+	descriptors = []float32{-4, 9}
+	DescriptorSquareRoot(descriptors, 2)
+	if !reflect.DeepEqual(descriptors, []float32{-2, 3}) {
+		t.Errorf("square roots = %v, want [-2 3]", descriptors)
+	}
+}
+
+func TestDescriptorTransformsRejectPartialRows(t *testing.T) {
+	for _, transform := range []DescriptorTransform{DescriptorL1Normalize, DescriptorL2Normalize, DescriptorSquareRoot, RootSIFT, DescriptorClip(1), DescriptorScale(1)} {
+		if err := transform(make([]float32, 5), 2); err == nil {
+			t.Error("a transform accepted 5 values of dimension 2")
+		}
+		if err := transform(nil, 0); err == nil {
+			t.Error("a transform accepted dimension 0")
+		}
+	}
+}
+
+func TestQuantizeUint8(t *testing.T) {
+	quantized, err := QuantizeUint8([]float32{-0.1, 0, 0.1, 0.3, 0.6, 2}, 3, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(quantized, []uint8{0, 0, 51, 153, 255, 255}) {
+		t.Errorf("quantized = %v", quantized)
+	}
+	descriptors, err := DequantizeUint8(quantized, 3, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if descriptors[3] != 153.0/512 {
+		t.Errorf("dequantized = %v", descriptors)
+	}
+	if _, err := DequantizeUint8(quantized, 3, 0); err == nil {
+		t.Error("DequantizeUint8 accepted scale 0")
+	}
+	if _, err := QuantizeUint8(make([]float32, 4), 3, 512); err == nil {
+		t.Error("QuantizeUint8 accepted a partial row")
+	}
+}
@@ -5,7 +5,6 @@ package vlfeat
 #include <fisher.h>
 */
 import "C"
-import "unsafe"
 
 type FisherFlag int
 
@@ -20,7 +19,10 @@ const (
 func FisherEncode(dataType VlType, means interface{}, dimension, numClusters uint, covariances, priors, data interface{}, numData uint, flag FisherFlag) (uint, []float64, error) {
 	encLength := 2 * int(dimension*numClusters)
 	enc := make([]float64, encLength)
-	cEnc := make([]C.double, encLength)
+	encPtr, _, err := ToCVlTypeArrayPtr(enc, dataType)
+	if err != nil {
+		return 0, enc, err
+	}
 	meansPtr, _, err := ToCVlTypeArrayPtr(means, dataType)
 	if err != nil {
 		return 0, enc, err
@@ -37,10 +39,6 @@ func FisherEncode(dataType VlType, means interface{}, dimension, numClusters uin
 	if err != nil {
 		return 0, enc, err
 	}
-	encPtr := unsafe.Pointer(&cEnc)
-	result := C.vl_fisher_encode(encPtr, C.vl_type(VlTypeFloat), meansPtr, C.uint(dimension), C.uint(numClusters), covariancesPtr, priorsPtr, dataPtr, C.uint(numData), C.int(flag))
-	for i, des := range cEnc {
-		enc[i] = float64(des)
-	}
-	return uint(result), enc, nil
+	result := C.vl_fisher_encode(encPtr, C.vl_type(dataType), meansPtr, C.uint(dimension), C.uint(numClusters), covariancesPtr, priorsPtr, dataPtr, C.uint(numData), C.int(flag))
+	return uint(result), fromCVlTypeArrayPtr(encPtr, dataType, encLength), nil
 }
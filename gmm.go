@@ -6,6 +6,8 @@ package vlfeat
 */
 import "C"
 import (
+	"errors"
+	"math"
 	"reflect"
 	"unsafe"
 )
@@ -51,7 +53,8 @@ func (gmm *GMM) Cluster(data interface{}) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	return float64(C.vl_gmm_cluster(gmm.p, dataPtr, C.uint(length))), nil
+	numData := uint(length) / gmm.GetDimension()
+	return float64(C.vl_gmm_cluster(gmm.p, dataPtr, C.uint(numData))), nil
 }
 
 // https://www.vlfeat.org/api/gmm_8c.html#aab9d461e2fca63960f2751ae86946804
@@ -61,7 +64,8 @@ func (gmm *GMM) InitWithRandData(data interface{}) error {
 	if err != nil {
 		return err
 	}
-	C.vl_gmm_init_with_rand_data(gmm.p, dataPtr, C.uint(length))
+	numData := uint(length) / gmm.GetDimension()
+	C.vl_gmm_init_with_rand_data(gmm.p, dataPtr, C.uint(numData))
 	return nil
 }
 
@@ -72,10 +76,42 @@ func (gmm *GMM) InitWithKmeans(data interface{}, kmeansInit Kmeans) error {
 	if err != nil {
 		return err
 	}
-	C.vl_gmm_init_with_kmeans(gmm.p, dataPtr, C.uint(length), kmeansInit.p)
+	numData := uint(length) / gmm.GetDimension()
+	C.vl_gmm_init_with_kmeans(gmm.p, dataPtr, C.uint(numData), kmeansInit.p)
 	return nil
 }
 
+// InitWithParameters sets the means, covariances and priors EM starts from
+// and switches the initialization to VlGMMCustom.
+func (gmm *GMM) InitWithParameters(means, covariances, priors interface{}) error {
+	if err := gmm.SetMeans(means); err != nil {
+		return err
+	}
+	if err := gmm.SetCovariances(covariances); err != nil {
+		return err
+	}
+	if err := gmm.SetPriors(priors); err != nil {
+		return err
+	}
+	gmm.SetInitialization(VlGMMCustom)
+	return nil
+}
+
+// Init initializes the parameters from data according to GetInitialization.
+// VlGMMCustom keeps the parameters already set.
+func (gmm *GMM) Init(data interface{}) error {
+	switch gmm.GetInitialization() {
+	case VlGMMKMeans:
+		// vlfeat creates its own Kmeans when no init object was set
+		return gmm.InitWithKmeans(data, gmm.GetKmeansInitObject())
+	case VlGMMRand:
+		return gmm.InitWithRandData(data)
+	case VlGMMCustom:
+		return nil
+	}
+	return errors.New("unknown GMM initialization")
+}
+
 // https://www.vlfeat.org/api/gmm_8c.html#a4f8f3fc91d284a2866fc5fd5d5b48dfd
 func (gmm *GMM) Em(data interface{}) (float64, error) {
 	vltype := gmm.GetDataType()
@@ -83,7 +119,8 @@ func (gmm *GMM) Em(data interface{}) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	em := C.vl_gmm_em(gmm.p, dataPtr, C.uint(length))
+	numData := uint(length) / gmm.GetDimension()
+	em := C.vl_gmm_em(gmm.p, dataPtr, C.uint(numData))
 	return float64(em), nil
 }
 
@@ -137,7 +174,7 @@ func (gmm *GMM) SetVerbosity(verbosity int) {
 
 // https://www.vlfeat.org/api/gmm_8c.html#a3f34a10ef70b880a81eabce9fc29cc2e
 func (gmm *GMM) SetInitialization(init VlGMMInitialization) {
-	C.vl_gmm_set_verbosity(gmm.p, C.int(init))
+	C.vl_gmm_set_initialization(gmm.p, C.VlGMMInitialization(init))
 }
 
 // https://www.vlfeat.org/api/gmm_8c.html#ae740ca4d9c354ac9d83c89127bce744c
@@ -246,3 +283,152 @@ func (gmm *GMM) GetCovarianceLowerBounds() []float64 {
 func (gmm *GMM) GetKmeansInitObject() Kmeans {
 	return Kmeans{p: C.vl_gmm_get_kmeans_init_object(gmm.p)}
 }
+
+/* Typed access to the parameters */
+
+func reshapeFloat64(values []float64, rows, cols int) [][]float64 {
+	matrix := make([][]float64, rows)
+	for i := range matrix {
+		matrix[i] = values[i*cols : (i+1)*cols : (i+1)*cols]
+	}
+	return matrix
+}
+
+func reshapeFloat32(values []float64, rows, cols int) [][]float32 {
+	matrix := make([][]float32, rows)
+	for i := range matrix {
+		matrix[i] = make([]float32, cols)
+		for j := range matrix[i] {
+			matrix[i][j] = float32(values[i*cols+j])
+		}
+	}
+	return matrix
+}
+
+func toFloat32Slice(values []float64) []float32 {
+	result := make([]float32, len(values))
+	for i, v := range values {
+		result[i] = float32(v)
+	}
+	return result
+}
+
+func (gmm *GMM) getMeans() []float64 {
+	length := int(gmm.GetDimension() * gmm.GetNumClusters())
+	return fromCVlTypeArrayPtr(gmm.GetMeans(), gmm.GetDataType(), length)
+}
+
+func (gmm *GMM) getCovariances() []float64 {
+	length := int(gmm.GetDimension() * gmm.GetNumClusters())
+	return fromCVlTypeArrayPtr(gmm.GetCovariances(), gmm.GetDataType(), length)
+}
+
+func (gmm *GMM) getPriors() []float64 {
+	return fromCVlTypeArrayPtr(gmm.GetPriors(), gmm.GetDataType(), int(gmm.GetNumClusters()))
+}
+
+func (gmm *GMM) getPosteriors() []float64 {
+	length := int(gmm.GetNumData() * gmm.GetNumClusters())
+	return fromCVlTypeArrayPtr(gmm.GetPosteriors(), gmm.GetDataType(), length)
+}
+
+// GetMeansFloat64 returns a copy of the means, numClusters rows of dimension values
+func (gmm *GMM) GetMeansFloat64() [][]float64 {
+	return reshapeFloat64(gmm.getMeans(), int(gmm.GetNumClusters()), int(gmm.GetDimension()))
+}
+
+// GetMeansFloat32 returns a copy of the means, numClusters rows of dimension values
+func (gmm *GMM) GetMeansFloat32() [][]float32 {
+	return reshapeFloat32(gmm.getMeans(), int(gmm.GetNumClusters()), int(gmm.GetDimension()))
+}
+
+// GetCovariancesFloat64 returns a copy of the diagonal covariances, numClusters rows of dimension values
+func (gmm *GMM) GetCovariancesFloat64() [][]float64 {
+	return reshapeFloat64(gmm.getCovariances(), int(gmm.GetNumClusters()), int(gmm.GetDimension()))
+}
+
+// GetCovariancesFloat32 returns a copy of the diagonal covariances, numClusters rows of dimension values
+func (gmm *GMM) GetCovariancesFloat32() [][]float32 {
+	return reshapeFloat32(gmm.getCovariances(), int(gmm.GetNumClusters()), int(gmm.GetDimension()))
+}
+
+func (gmm *GMM) GetPriorsFloat64() []float64 {
+	return gmm.getPriors()
+}
+
+func (gmm *GMM) GetPriorsFloat32() []float32 {
+	return toFloat32Slice(gmm.getPriors())
+}
+
+// GetPosteriorsFloat64 returns a copy of the posteriors of the training data, numData rows of numClusters values
+func (gmm *GMM) GetPosteriorsFloat64() [][]float64 {
+	return reshapeFloat64(gmm.getPosteriors(), int(gmm.GetNumData()), int(gmm.GetNumClusters()))
+}
+
+// GetPosteriorsFloat32 returns a copy of the posteriors of the training data, numData rows of numClusters values
+func (gmm *GMM) GetPosteriorsFloat32() [][]float32 {
+	return reshapeFloat32(gmm.getPosteriors(), int(gmm.GetNumData()), int(gmm.GetNumClusters()))
+}
+
+/* Posteriors of new data */
+
+// gmmPosteriors computes the posteriors (numData rows of numClusters values) and the
+// log-likelihood of each sample under a diagonal covariance mixture, like
+// vl_get_gmm_data_posteriors does.
+func gmmPosteriors(means, covariances, priors []float64, dimension, numClusters int, data []float64) ([][]float64, []float64) {
+	numData := len(data) / dimension
+	logNorm := make([]float64, numClusters)
+	for k := 0; k < numClusters; k++ {
+		logDet := 0.0
+		for d := 0; d < dimension; d++ {
+			logDet += math.Log(covariances[k*dimension+d])
+		}
+		logNorm[k] = math.Log(priors[k]) - 0.5*(float64(dimension)*math.Log(2*math.Pi)+logDet)
+	}
+
+	posteriors := reshapeFloat64(make([]float64, numData*numClusters), numData, numClusters)
+	logLikelihoods := make([]float64, numData)
+	for i := 0; i < numData; i++ {
+		x := data[i*dimension : (i+1)*dimension]
+		row := posteriors[i]
+		maxLog := math.Inf(-1)
+		for k := 0; k < numClusters; k++ {
+			if priors[k] <= 0 {
+				row[k] = math.Inf(-1)
+				continue
+			}
+			mahalanobis := 0.0
+			for d, v := range x {
+				diff := v - means[k*dimension+d]
+				mahalanobis += diff * diff / covariances[k*dimension+d]
+			}
+			row[k] = logNorm[k] - 0.5*mahalanobis
+			maxLog = math.Max(maxLog, row[k])
+		}
+		sum := 0.0
+		for k := range row {
+			row[k] = math.Exp(row[k] - maxLog)
+			sum += row[k]
+		}
+		for k := range row {
+			row[k] /= sum
+		}
+		logLikelihoods[i] = maxLog + math.Log(sum)
+	}
+	return posteriors, logLikelihoods
+}
+
+// ComputePosteriors returns the posteriors (numData rows of numClusters values) and the
+// log-likelihood of each sample of data under the current parameters, without retraining.
+func (gmm *GMM) ComputePosteriors(data interface{}) ([][]float64, []float64, error) {
+	values, err := toFloat64Slice(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	dimension := int(gmm.GetDimension())
+	if len(values) == 0 || len(values)%dimension != 0 {
+		return nil, nil, errors.New("data length must be a non-zero multiple of dimension")
+	}
+	posteriors, logLikelihoods := gmmPosteriors(gmm.getMeans(), gmm.getCovariances(), gmm.getPriors(), dimension, int(gmm.GetNumClusters()), values)
+	return posteriors, logLikelihoods, nil
+}
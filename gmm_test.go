@@ -0,0 +1,77 @@
+package vlfeat
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestGMMPosteriors(t *testing.T) {
+	// two unit variance components at -1 and 1 with priors 1/4 and 3/4
+	means := []float64{-1, 1}
+	covariances := []float64{1, 1}
+	priors := []float64{0.25, 0.75}
+	posteriors, logLikelihoods := gmmPosteriors(means, covariances, priors, 1, 2, []float64{0, 5})
+
+	// at 0 both densities are equal, the posteriors are the priors
+	if math.Abs(posteriors[0][0]-0.25) > 1e-12 || math.Abs(posteriors[0][1]-0.75) > 1e-12 {
+		t.Errorf("posteriors at 0 = %v, want the priors", posteriors[0])
+	}
+	want := -0.5*math.Log(2*math.Pi) - 0.5
+	if math.Abs(logLikelihoods[0]-want) > 1e-12 {
+		t.Errorf("log-likelihood at 0 = %g, want %g", logLikelihoods[0], want)
+	}
+	// far on the right, the log-likelihood does not underflow
+	ratio := 0.25 / 0.75 * math.Exp(-0.5*36+0.5*16)
+	if math.Abs(posteriors[1][0]-ratio/(1+ratio)) > 1e-12 {
+		t.Errorf("posterior of component 0 at 5 = %g, want %g", posteriors[1][0], ratio/(1+ratio))
+	}
+}
+
+func TestGMMPosteriorsMatchGoGMM(t *testing.T) {
+	// a diagonal GoGMM holds the same model with full matrices
+	gmm := NewGoGMM(CovarianceDiagonal, 2, 2)
+	gmm.SetMeans([]float64{0, 0, 3, -1})
+	gmm.SetCovariances([]float64{1, 2, 0.5, 4})
+	gmm.SetPriors([]float64{0.4, 0.6})
+	data := []float64{0, 1, 2, -1, 5, 5, -3, 0.5}
+	want, wantLogLikelihoods, err := gmm.ComputePosteriors(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posteriors, logLikelihoods := gmmPosteriors([]float64{0, 0, 3, -1}, []float64{1, 2, 0.5, 4}, []float64{0.4, 0.6}, 2, 2, data)
+	for i := range posteriors {
+		if math.Abs(logLikelihoods[i]-wantLogLikelihoods[i]) > 1e-12 {
+			t.Errorf("log-likelihood %d = %g, want %g", i, logLikelihoods[i], wantLogLikelihoods[i])
+		}
+		for k := range posteriors[i] {
+			if math.Abs(posteriors[i][k]-want[i][k]) > 1e-12 {
+				t.Errorf("posterior (%d, %d) = %g, want %g", i, k, posteriors[i][k], want[i][k])
+			}
+		}
+	}
+}
+
+func TestToFloat64Slice(t *testing.T) {
+	for _, data := range []interface{}{
+		[]float64{1, -2, 3},
+		[]float32{1, -2, 3},
+		[]int{1, -2, 3},
+		[3]int8{1, -2, 3},
+	} {
+		values, err := toFloat64Slice(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(values, []float64{1, -2, 3}) {
+			t.Errorf("%T: values = %v", data, values)
+		}
+	}
+	if _, err := toFloat64Slice([]string{"1"}); err == nil {
+		t.Error("toFloat64Slice accepted strings")
+	}
+	matrix := reshapeFloat64([]float64{1, 2, 3, 4, 5, 6}, 2, 3)
+	if !reflect.DeepEqual(matrix, [][]float64{{1, 2, 3}, {4, 5, 6}}) || cap(matrix[0]) != 3 {
+		t.Errorf("reshaped = %v with row capacity %d", matrix, cap(matrix[0]))
+	}
+}
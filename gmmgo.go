@@ -0,0 +1,557 @@
+package vlfeat
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+type CovarianceType int
+
+const (
+	CovarianceDiagonal CovarianceType = 0
+	CovarianceFull     CovarianceType = 1
+)
+
+// GaussianMixture is implemented by GMM (vlfeat, diagonal covariances) and
+// GoGMM (Go-side EM, diagonal or full covariances).
+type GaussianMixture interface {
+	Cluster(data interface{}) (float64, error)
+	Em(data interface{}) (float64, error)
+	ComputePosteriors(data interface{}) ([][]float64, []float64, error)
+	GetDimension() uint
+	GetNumClusters() uint
+	GetLoglikelihood() float64
+	GetMeansFloat64() [][]float64
+	GetPriorsFloat64() []float64
+	GetPosteriorsFloat64() [][]float64
+	Delete()
+}
+
+var (
+	_ GaussianMixture = (*GMM)(nil)
+	_ GaussianMixture = (*GoGMM)(nil)
+)
+
+// NewGaussianMixture returns a vlfeat GMM for diagonal covariances and a GoGMM for full ones.
+func NewGaussianMixture(covarianceType CovarianceType, dimension, numComponents uint) GaussianMixture {
+	if covarianceType == CovarianceFull {
+		gmm := NewGoGMM(CovarianceFull, dimension, numComponents)
+		return &gmm
+	}
+	gmm := NewGMM(VlTypeDouble, dimension, numComponents)
+	return &gmm
+}
+
+// GoGMM is a gaussian mixture trained by EM in Go. Unlike GMM it supports full
+// covariance matrices, which suits low-dimensional data such as colours.
+// Covariances are stored as dimension x dimension row-major matrices, with zero
+// off-diagonal entries for CovarianceDiagonal.
+type GoGMM struct {
+	covarianceType      CovarianceType
+	dimension           int
+	numClusters         int
+	maxNumIterations    uint
+	numRepetitions      uint
+	regularization      float64
+	initialization      VlGMMInitialization
+	minLoglikelihoodVar float64
+	rand                *rand.Rand
+
+	means         []float64
+	covariances   []float64
+	priors        []float64
+	posteriors    []float64
+	numData       int
+	loglikelihood float64
+}
+
+// NewGoGMM returns a Go-side GMM initialized with k-means, 50 iterations and a
+// covariance regularization of 1e-6.
+func NewGoGMM(covarianceType CovarianceType, dimension, numComponents uint) GoGMM {
+	return GoGMM{
+		covarianceType:      covarianceType,
+		dimension:           int(dimension),
+		numClusters:         int(numComponents),
+		maxNumIterations:    50,
+		numRepetitions:      1,
+		regularization:      1e-6,
+		initialization:      VlGMMKMeans,
+		minLoglikelihoodVar: 1e-6,
+		rand:                rand.New(rand.NewSource(1)),
+	}
+}
+
+// Delete does nothing, GoGMM holds no C memory
+func (gmm *GoGMM) Delete() {}
+
+/* Set parameters */
+
+func (gmm *GoGMM) SetMaxNumIterations(maxNumIterations uint) {
+	gmm.maxNumIterations = maxNumIterations
+}
+
+func (gmm *GoGMM) SetNumRepetitions(numRepetitions uint) {
+	gmm.numRepetitions = numRepetitions
+}
+
+// SetRegularization sets the value added to the diagonal of every covariance
+func (gmm *GoGMM) SetRegularization(regularization float64) {
+	gmm.regularization = regularization
+}
+
+func (gmm *GoGMM) SetInitialization(init VlGMMInitialization) {
+	gmm.initialization = init
+}
+
+func (gmm *GoGMM) SetSeed(seed int64) {
+	gmm.rand = rand.New(rand.NewSource(seed))
+}
+
+func (gmm *GoGMM) SetMeans(means interface{}) error {
+	values, err := toFloat64Slice(means)
+	if err != nil {
+		return err
+	}
+	if len(values) != gmm.numClusters*gmm.dimension {
+		return errors.New("means must hold numClusters x dimension values")
+	}
+	gmm.means = append([]float64{}, values...)
+	return nil
+}
+
+// SetCovariances accepts numClusters diagonals (numClusters x dimension values) or
+// numClusters full matrices (numClusters x dimension x dimension values).
+func (gmm *GoGMM) SetCovariances(covariances interface{}) error {
+	values, err := toFloat64Slice(covariances)
+	if err != nil {
+		return err
+	}
+	d := gmm.dimension
+	switch len(values) {
+	case gmm.numClusters * d * d:
+		gmm.covariances = append([]float64{}, values...)
+	case gmm.numClusters * d:
+		gmm.covariances = make([]float64, gmm.numClusters*d*d)
+		for k := 0; k < gmm.numClusters; k++ {
+			for i := 0; i < d; i++ {
+				gmm.covariances[k*d*d+i*d+i] = values[k*d+i]
+			}
+		}
+	default:
+		return errors.New("covariances must hold numClusters diagonals or full matrices")
+	}
+	// user-supplied covariances are kept as they are, only EM regularizes
+	gmm.projectCovariances(0)
+	return nil
+}
+
+func (gmm *GoGMM) SetPriors(priors interface{}) error {
+	values, err := toFloat64Slice(priors)
+	if err != nil {
+		return err
+	}
+	if len(values) != gmm.numClusters {
+		return errors.New("priors must hold numClusters values")
+	}
+	gmm.priors = append([]float64{}, values...)
+	return nil
+}
+
+/* Retrieve data and parameters */
+
+func (gmm *GoGMM) GetCovarianceType() CovarianceType {
+	return gmm.covarianceType
+}
+
+func (gmm *GoGMM) GetDimension() uint {
+	return uint(gmm.dimension)
+}
+
+func (gmm *GoGMM) GetNumClusters() uint {
+	return uint(gmm.numClusters)
+}
+
+func (gmm *GoGMM) GetNumData() uint {
+	return uint(gmm.numData)
+}
+
+func (gmm *GoGMM) GetMaxNumIterations() uint {
+	return gmm.maxNumIterations
+}
+
+func (gmm *GoGMM) GetNumRepetitions() uint {
+	return gmm.numRepetitions
+}
+
+func (gmm *GoGMM) GetRegularization() float64 {
+	return gmm.regularization
+}
+
+func (gmm *GoGMM) GetInitialization() VlGMMInitialization {
+	return gmm.initialization
+}
+
+func (gmm *GoGMM) GetLoglikelihood() float64 {
+	return gmm.loglikelihood
+}
+
+// GetMeansFloat64 returns a copy of the means, numClusters rows of dimension values
+func (gmm *GoGMM) GetMeansFloat64() [][]float64 {
+	return reshapeFloat64(append([]float64{}, gmm.means...), len(gmm.means)/gmm.dimension, gmm.dimension)
+}
+
+// GetCovariancesFloat64 returns a copy of the covariances, numClusters rows of
+// dimension x dimension values
+func (gmm *GoGMM) GetCovariancesFloat64() [][]float64 {
+	d := gmm.dimension
+	return reshapeFloat64(append([]float64{}, gmm.covariances...), len(gmm.covariances)/(d*d), d*d)
+}
+
+func (gmm *GoGMM) GetPriorsFloat64() []float64 {
+	return append([]float64{}, gmm.priors...)
+}
+
+// GetPosteriorsFloat64 returns a copy of the posteriors of the training data, numData rows of numClusters values
+func (gmm *GoGMM) GetPosteriorsFloat64() [][]float64 {
+	return reshapeFloat64(append([]float64{}, gmm.posteriors...), gmm.numData, gmm.numClusters)
+}
+
+/* Process data */
+
+func (gmm *GoGMM) toData(data interface{}) ([]float64, int, error) {
+	values, err := toFloat64Slice(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(values) == 0 || len(values)%gmm.dimension != 0 {
+		return nil, 0, errors.New("data length must be a non-zero multiple of dimension")
+	}
+	return values, len(values) / gmm.dimension, nil
+}
+
+// Cluster initializes the parameters and runs EM NumRepetitions times, keeping the
+// parameters with the highest log-likelihood.
+func (gmm *GoGMM) Cluster(data interface{}) (float64, error) {
+	values, numData, err := gmm.toData(data)
+	if err != nil {
+		return 0, err
+	}
+	if numData < gmm.numClusters {
+		return 0, errors.New("GoGMM needs at least numClusters data")
+	}
+	repetitions := gmm.numRepetitions
+	if repetitions == 0 || gmm.initialization == VlGMMCustom {
+		repetitions = 1
+	}
+	var best GoGMM
+	for r := uint(0); r < repetitions; r++ {
+		if err := gmm.init(values, numData); err != nil {
+			return 0, err
+		}
+		if err := gmm.em(values, numData); err != nil {
+			return 0, err
+		}
+		if r == 0 || gmm.loglikelihood > best.loglikelihood {
+			best = *gmm
+		}
+	}
+	*gmm = best
+	return gmm.loglikelihood, nil
+}
+
+// Em runs EM from the current parameters.
+func (gmm *GoGMM) Em(data interface{}) (float64, error) {
+	values, numData, err := gmm.toData(data)
+	if err != nil {
+		return 0, err
+	}
+	if gmm.means == nil || gmm.covariances == nil || gmm.priors == nil {
+		return 0, errors.New("GoGMM parameters must be initialized before Em")
+	}
+	if err := gmm.em(values, numData); err != nil {
+		return 0, err
+	}
+	return gmm.loglikelihood, nil
+}
+
+// ComputePosteriors returns the posteriors (numData rows of numClusters values) and the
+// log-likelihood of each sample of data under the current parameters.
+func (gmm *GoGMM) ComputePosteriors(data interface{}) ([][]float64, []float64, error) {
+	values, numData, err := gmm.toData(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	posteriors := make([]float64, numData*gmm.numClusters)
+	logLikelihoods, err := gmm.expectation(values, numData, posteriors)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reshapeFloat64(posteriors, numData, gmm.numClusters), logLikelihoods, nil
+}
+
+// init sets the initial parameters according to the initialization method
+func (gmm *GoGMM) init(data []float64, numData int) error {
+	d := gmm.dimension
+	switch gmm.initialization {
+	case VlGMMCustom:
+		if gmm.means == nil || gmm.covariances == nil || gmm.priors == nil {
+			return errors.New("VlGMMCustom needs means, covariances and priors")
+		}
+		return nil
+	case VlGMMRand:
+		gmm.means = make([]float64, gmm.numClusters*d)
+		for k, i := range gmm.rand.Perm(numData)[:gmm.numClusters] {
+			copy(gmm.means[k*d:(k+1)*d], data[i*d:(i+1)*d])
+		}
+		assignments := make([]uint, numData)
+		for i := range assignments {
+			assignments[i] = uint(gmm.nearestMean(data[i*d : (i+1)*d]))
+		}
+		gmm.initFromAssignments(data, numData, assignments)
+		return nil
+	}
+	kmeans, err := NewKeans(VlTypeDouble, VlDistanceL2)
+	if err != nil {
+		return err
+	}
+	defer kmeans.Delete()
+	if _, err := kmeans.Cluster(data, uint(d), uint(numData), uint(gmm.numClusters)); err != nil {
+		return err
+	}
+	assignments, _, err := kmeans.Quantize(data, uint(numData))
+	if err != nil {
+		return err
+	}
+	gmm.means = kmeans.GetCenters()
+	gmm.initFromAssignments(data, numData, assignments)
+	return nil
+}
+
+func (gmm *GoGMM) nearestMean(x []float64) int {
+	d := gmm.dimension
+	best, bestDist := 0, math.Inf(1)
+	for k := 0; k < gmm.numClusters; k++ {
+		dist := 0.0
+		for j, v := range x {
+			diff := v - gmm.means[k*d+j]
+			dist += diff * diff
+		}
+		if dist < bestDist {
+			best, bestDist = k, dist
+		}
+	}
+	return best
+}
+
+// initFromAssignments sets the covariances and priors from a hard assignment of the data
+func (gmm *GoGMM) initFromAssignments(data []float64, numData int, assignments []uint) {
+	posteriors := make([]float64, numData*gmm.numClusters)
+	for i, k := range assignments {
+		posteriors[i*gmm.numClusters+int(k)] = 1
+	}
+	means := gmm.means
+	gmm.maximization(data, numData, posteriors)
+	// keep the k-means centers as means, but use the covariances around them
+	gmm.means = means
+}
+
+// expectation fills posteriors and returns the log-likelihood of each sample
+func (gmm *GoGMM) expectation(data []float64, numData int, posteriors []float64) ([]float64, error) {
+	d := gmm.dimension
+	K := gmm.numClusters
+	factors := make([][]float64, K)
+	logNorm := make([]float64, K)
+	for k := 0; k < K; k++ {
+		factor, err := cholesky(gmm.covariances[k*d*d:(k+1)*d*d], d)
+		if err != nil {
+			return nil, err
+		}
+		logDet := 0.0
+		for i := 0; i < d; i++ {
+			logDet += 2 * math.Log(factor[i*d+i])
+		}
+		factors[k] = factor
+		logNorm[k] = math.Log(gmm.priors[k]) - 0.5*(float64(d)*math.Log(2*math.Pi)+logDet)
+	}
+
+	logLikelihoods := make([]float64, numData)
+	diff := make([]float64, d)
+	for i := 0; i < numData; i++ {
+		x := data[i*d : (i+1)*d]
+		row := posteriors[i*K : (i+1)*K]
+		maxLog := math.Inf(-1)
+		for k := 0; k < K; k++ {
+			if gmm.priors[k] <= 0 {
+				row[k] = math.Inf(-1)
+				continue
+			}
+			for j := range diff {
+				diff[j] = x[j] - gmm.means[k*d+j]
+			}
+			row[k] = logNorm[k] - 0.5*forwardSubstitutionNorm(factors[k], diff, d)
+			maxLog = math.Max(maxLog, row[k])
+		}
+		sum := 0.0
+		for k := range row {
+			row[k] = math.Exp(row[k] - maxLog)
+			sum += row[k]
+		}
+		for k := range row {
+			row[k] /= sum
+		}
+		logLikelihoods[i] = maxLog + math.Log(sum)
+	}
+	return logLikelihoods, nil
+}
+
+// maximization updates the parameters from the posteriors
+func (gmm *GoGMM) maximization(data []float64, numData int, posteriors []float64) {
+	d := gmm.dimension
+	K := gmm.numClusters
+	gmm.means = make([]float64, K*d)
+	gmm.covariances = make([]float64, K*d*d)
+	gmm.priors = make([]float64, K)
+	mean := make([]float64, d)
+	for k := 0; k < K; k++ {
+		mass := 0.0
+		for i := 0; i < numData; i++ {
+			mass += posteriors[i*K+k]
+		}
+		if mass <= 0 {
+			// empty cluster, restart it on a random sample
+			i := gmm.rand.Intn(numData)
+			copy(gmm.means[k*d:(k+1)*d], data[i*d:(i+1)*d])
+			for j := 0; j < d; j++ {
+				gmm.covariances[k*d*d+j*d+j] = 1
+			}
+			gmm.priors[k] = 1 / float64(numData)
+			continue
+		}
+		gmm.priors[k] = mass / float64(numData)
+		for j := range mean {
+			mean[j] = 0
+		}
+		for i := 0; i < numData; i++ {
+			p := posteriors[i*K+k]
+			for j := 0; j < d; j++ {
+				mean[j] += p * data[i*d+j]
+			}
+		}
+		for j := range mean {
+			mean[j] /= mass
+		}
+		copy(gmm.means[k*d:(k+1)*d], mean)
+		cov := gmm.covariances[k*d*d : (k+1)*d*d]
+		for i := 0; i < numData; i++ {
+			p := posteriors[i*K+k]
+			if p == 0 {
+				continue
+			}
+			x := data[i*d : (i+1)*d]
+			for a := 0; a < d; a++ {
+				da := x[a] - mean[a]
+				for b := a; b < d; b++ {
+					cov[a*d+b] += p * da * (x[b] - mean[b])
+				}
+			}
+		}
+		for a := 0; a < d; a++ {
+			for b := a; b < d; b++ {
+				cov[a*d+b] /= mass
+				cov[b*d+a] = cov[a*d+b]
+			}
+		}
+	}
+	gmm.projectCovariances(gmm.regularization)
+	sum := 0.0
+	for _, p := range gmm.priors {
+		sum += p
+	}
+	for k := range gmm.priors {
+		gmm.priors[k] /= sum
+	}
+}
+
+// projectCovariances drops off-diagonal terms for diagonal mixtures and adds
+// regularization to the diagonals
+func (gmm *GoGMM) projectCovariances(regularization float64) {
+	d := gmm.dimension
+	for k := 0; k < len(gmm.covariances)/(d*d); k++ {
+		cov := gmm.covariances[k*d*d : (k+1)*d*d]
+		for a := 0; a < d; a++ {
+			if gmm.covarianceType == CovarianceDiagonal {
+				for b := 0; b < d; b++ {
+					if a != b {
+						cov[a*d+b] = 0
+					}
+				}
+			}
+			cov[a*d+a] += regularization
+		}
+	}
+}
+
+func (gmm *GoGMM) em(data []float64, numData int) error {
+	gmm.numData = numData
+	gmm.posteriors = make([]float64, numData*gmm.numClusters)
+	previous := math.Inf(-1)
+	// every maximization is followed by an expectation, so that the posteriors and the
+	// log-likelihood always match the returned parameters
+	for iteration := uint(0); ; iteration++ {
+		logLikelihoods, err := gmm.expectation(data, numData, gmm.posteriors)
+		if err != nil {
+			return err
+		}
+		gmm.loglikelihood = 0
+		for _, l := range logLikelihoods {
+			gmm.loglikelihood += l
+		}
+		if iteration == gmm.maxNumIterations {
+			break
+		}
+		if iteration > 0 && gmm.loglikelihood-previous < gmm.minLoglikelihoodVar*math.Abs(gmm.loglikelihood) {
+			break
+		}
+		previous = gmm.loglikelihood
+		gmm.maximization(data, numData, gmm.posteriors)
+	}
+	return nil
+}
+
+// cholesky returns the lower triangular factor L of a = L L^T
+func cholesky(a []float64, d int) ([]float64, error) {
+	l := make([]float64, d*d)
+	for i := 0; i < d; i++ {
+		for j := 0; j <= i; j++ {
+			sum := a[i*d+j]
+			for k := 0; k < j; k++ {
+				sum -= l[i*d+k] * l[j*d+k]
+			}
+			if i == j {
+				if sum <= 0 {
+					return nil, errors.New("covariance is not positive definite, increase the regularization")
+				}
+				l[i*d+i] = math.Sqrt(sum)
+			} else {
+				l[i*d+j] = sum / l[j*d+j]
+			}
+		}
+	}
+	return l, nil
+}
+
+// forwardSubstitutionNorm returns |L^-1 x|^2, the squared mahalanobis distance of x
+func forwardSubstitutionNorm(l, x []float64, d int) float64 {
+	y := make([]float64, d)
+	norm := 0.0
+	for i := 0; i < d; i++ {
+		sum := x[i]
+		for k := 0; k < i; k++ {
+			sum -= l[i*d+k] * y[k]
+		}
+		y[i] = sum / l[i*d+i]
+		norm += y[i] * y[i]
+	}
+	return norm
+}
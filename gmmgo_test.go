@@ -0,0 +1,132 @@
+package vlfeat
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// correlatedClusters draws numData samples around (-10, 0) and (10, 0), with
+// covariance [[1, 0.8], [0.8, 1]]
+func correlatedClusters(numData int) []float64 {
+	random := rand.New(rand.NewSource(1))
+	data := make([]float64, 0, 2*numData)
+	for i := 0; i < numData; i++ {
+		u, v := random.NormFloat64(), random.NormFloat64()
+		center := -10.0
+		if i%2 == 1 {
+			center = 10
+		}
+		data = append(data, center+u, 0.8*u+0.6*v)
+	}
+	return data
+}
+
+func TestGoGMMFullCovariance(t *testing.T) {
+	gmm := NewGoGMM(CovarianceFull, 2, 2)
+	gmm.SetInitialization(VlGMMRand)
+	gmm.SetNumRepetitions(3)
+	if _, err := gmm.Cluster(correlatedClusters(4000)); err != nil {
+		t.Fatal(err)
+	}
+	means := gmm.GetMeansFloat64()
+	covariances := gmm.GetCovariancesFloat64()
+	for k := range means {
+		if math.Abs(math.Abs(means[k][0])-10) > 0.1 || math.Abs(means[k][1]) > 0.1 {
+			t.Errorf("mean %d = %v, want (+-10, 0)", k, means[k])
+		}
+		for i, want := range []float64{1, 0.8, 0.8, 1} {
+			if math.Abs(covariances[k][i]-want) > 0.1 {
+				t.Errorf("covariance %d = %v, want [1 0.8 0.8 1]", k, covariances[k])
+				break
+			}
+		}
+	}
+}
+
+func TestGoGMMDiagonalCovariance(t *testing.T) {
+	gmm := NewGoGMM(CovarianceDiagonal, 2, 2)
+	gmm.SetInitialization(VlGMMRand)
+	if _, err := gmm.Cluster(correlatedClusters(1000)); err != nil {
+		t.Fatal(err)
+	}
+	for k, covariance := range gmm.GetCovariancesFloat64() {
+		if covariance[1] != 0 || covariance[2] != 0 {
+			t.Errorf("covariance %d = %v, want a diagonal matrix", k, covariance)
+		}
+	}
+}
+
+func TestGoGMMStateMatchesParameters(t *testing.T) {
+	data := correlatedClusters(500)
+	for _, maxNumIterations := range []uint{0, 1, 3} {
+		gmm := NewGoGMM(CovarianceFull, 2, 2)
+		gmm.SetInitialization(VlGMMRand)
+		gmm.SetMaxNumIterations(maxNumIterations)
+		loglikelihood, err := gmm.Cluster(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		posteriors, logLikelihoods, err := gmm.ComputePosteriors(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := 0.0
+		for _, l := range logLikelihoods {
+			sum += l
+		}
+		if math.Abs(sum-loglikelihood) > 1e-9*math.Abs(sum) {
+			t.Errorf("%d iterations: log-likelihood %g, parameters give %g", maxNumIterations, loglikelihood, sum)
+		}
+		trained := gmm.GetPosteriorsFloat64()
+		for i := range posteriors {
+			for k := range posteriors[i] {
+				if math.Abs(posteriors[i][k]-trained[i][k]) > 1e-12 {
+					t.Fatalf("%d iterations: posterior (%d, %d) = %g, parameters give %g", maxNumIterations, i, k, trained[i][k], posteriors[i][k])
+				}
+			}
+		}
+	}
+}
+
+func TestGoGMMSetCovariancesKeepsValues(t *testing.T) {
+	gmm := NewGoGMM(CovarianceDiagonal, 2, 1)
+	if err := gmm.SetCovariances([]float64{2, 0.5, 0.5, 3}); err != nil {
+		t.Fatal(err)
+	}
+	covariance := gmm.GetCovariancesFloat64()[0]
+	for i, want := range []float64{2, 0, 0, 3} {
+		if covariance[i] != want {
+			t.Fatalf("covariance = %v, want [2 0 0 3]", covariance)
+		}
+	}
+}
+
+func TestGoGMMCustomInitialization(t *testing.T) {
+	gmm := NewGoGMM(CovarianceFull, 2, 2)
+	gmm.SetInitialization(VlGMMCustom)
+	data := correlatedClusters(200)
+	if _, err := gmm.Cluster(data); err == nil {
+		t.Fatal("VlGMMCustom trained without parameters")
+	}
+	means := []float64{-1, 0, 1, 0}
+	gmm.SetMeans(means)
+	gmm.SetCovariances([]float64{1, 0, 0, 1, 1, 0, 0, 1})
+	gmm.SetPriors([]float64{0.5, 0.5})
+	gmm.SetMaxNumIterations(0)
+	if _, err := gmm.Cluster(data); err != nil {
+		t.Fatal(err)
+	}
+	// without iterations the supplied parameters are kept
+	if got := gmm.GetMeansFloat64(); got[0][0] != -1 || got[1][0] != 1 {
+		t.Errorf("means = %v, want the supplied ones", got)
+	}
+	gmm.SetMaxNumIterations(50)
+	if _, err := gmm.Cluster(data); err != nil {
+		t.Fatal(err)
+	}
+	// EM starts from them, so the first mean converges to the left cluster
+	if got := gmm.GetMeansFloat64(); math.Abs(got[0][0]+10) > 0.2 || math.Abs(got[1][0]-10) > 0.2 {
+		t.Errorf("means = %v, want (-10, 0) then (10, 0)", got)
+	}
+}
@@ -0,0 +1,181 @@
+package vlfeat
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+type GMMSelectionCriterion int
+
+const (
+	GMMSelectBIC     GMMSelectionCriterion = 0
+	GMMSelectAIC     GMMSelectionCriterion = 1
+	GMMSelectHeldOut GMMSelectionCriterion = 2
+)
+
+// GMMSelectionOptions control SelectGMM. Components from MinComponents to MaxComponents
+// are tried every Step components (Step 0 means 1). NumWorkers GMMs are trained in
+// parallel (0 means 1). Configure, when set, is called on every GMM before training,
+// e.g. to set the number of iterations or the initialization.
+type GMMSelectionOptions struct {
+	MinComponents uint
+	MaxComponents uint
+	Step          uint
+	Criterion     GMMSelectionCriterion
+	NumWorkers    int
+	Configure     func(gmm *GMM)
+}
+
+// GMMSelectionResult is the score of the GMM trained with NumComponents components.
+// HeldOutLogLikelihood is the mean log-likelihood per held-out sample, NaN without held-out data.
+type GMMSelectionResult struct {
+	NumComponents        uint    `json:"numComponents"`
+	NumParameters        uint    `json:"numParameters"`
+	LogLikelihood        float64 `json:"logLikelihood"`
+	HeldOutLogLikelihood float64 `json:"heldOutLogLikelihood"`
+	BIC                  float64 `json:"bic"`
+	AIC                  float64 `json:"aic"`
+}
+
+type GMMSelectionReport []GMMSelectionResult
+
+// String formats the report as a table
+func (report GMMSelectionReport) String() string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "components\tparameters\tloglikelihood\theld-out\tBIC\tAIC\t")
+	for _, r := range report {
+		fmt.Fprintf(w, "%d\t%d\t%.4f\t%.4f\t%.4f\t%.4f\t\n", r.NumComponents, r.NumParameters, r.LogLikelihood, r.HeldOutLogLikelihood, r.BIC, r.AIC)
+	}
+	w.Flush()
+	return sb.String()
+}
+
+func (result GMMSelectionResult) score(criterion GMMSelectionCriterion) float64 {
+	switch criterion {
+	case GMMSelectAIC:
+		return result.AIC
+	case GMMSelectHeldOut:
+		return -result.HeldOutLogLikelihood
+	}
+	return result.BIC
+}
+
+// trainGMMForSelection trains one GMM with numComponents components and scores it
+func trainGMMForSelection(dataType VlType, dimension, numComponents uint, train, heldOut interface{}, numData int, configure func(gmm *GMM)) (GMM, GMMSelectionResult, error) {
+	gmm := NewGMM(dataType, dimension, numComponents)
+	if configure != nil {
+		configure(&gmm)
+	}
+	logLikelihood, err := gmm.Cluster(train)
+	if err != nil {
+		gmm.Delete()
+		return GMM{}, GMMSelectionResult{}, err
+	}
+	// means, diagonal covariances and priors summing to one
+	numParameters := numComponents*2*dimension + numComponents - 1
+	result := GMMSelectionResult{
+		NumComponents:        numComponents,
+		NumParameters:        numParameters,
+		LogLikelihood:        logLikelihood,
+		HeldOutLogLikelihood: math.NaN(),
+		BIC:                  -2*logLikelihood + float64(numParameters)*math.Log(float64(numData)),
+		AIC:                  -2*logLikelihood + 2*float64(numParameters),
+	}
+	if heldOut != nil {
+		_, logLikelihoods, err := gmm.ComputePosteriors(heldOut)
+		if err != nil {
+			gmm.Delete()
+			return GMM{}, GMMSelectionResult{}, err
+		}
+		sum := 0.0
+		for _, l := range logLikelihoods {
+			sum += l
+		}
+		result.HeldOutLogLikelihood = sum / float64(len(logLikelihoods))
+	}
+	return gmm, result, nil
+}
+
+// SelectGMM trains GMMs over a range of numbers of components on train and returns the best
+// one under options.Criterion with the report of all the candidates. heldOut may be nil
+// unless the criterion is GMMSelectHeldOut. The caller must Delete the returned GMM.
+func SelectGMM(dataType VlType, dimension uint, train, heldOut interface{}, options GMMSelectionOptions) (GMM, GMMSelectionReport, error) {
+	if dimension == 0 {
+		return GMM{}, nil, errors.New("dimension must be positive")
+	}
+	if options.MinComponents == 0 || options.MaxComponents < options.MinComponents {
+		return GMM{}, nil, errors.New("components range must satisfy 0 < MinComponents <= MaxComponents")
+	}
+	if options.Criterion == GMMSelectHeldOut && heldOut == nil {
+		return GMM{}, nil, errors.New("GMMSelectHeldOut needs held-out data")
+	}
+	values, err := toFloat64Slice(train)
+	if err != nil {
+		return GMM{}, nil, err
+	}
+	if len(values) == 0 || len(values)%int(dimension) != 0 {
+		return GMM{}, nil, errors.New("train length must be a non-zero multiple of dimension")
+	}
+	numData := len(values) / int(dimension)
+	step := options.Step
+	if step == 0 {
+		step = 1
+	}
+	numWorkers := options.NumWorkers
+	if numWorkers <= 0 {
+		numWorkers = 1
+	}
+
+	candidates := []uint{}
+	for k := options.MinComponents; k <= options.MaxComponents; k += step {
+		candidates = append(candidates, k)
+	}
+	models := make([]GMM, len(candidates))
+	report := make(GMMSelectionReport, len(candidates))
+	errs := make([]error, len(candidates))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				models[i], report[i], errs[i] = trainGMMForSelection(dataType, dimension, candidates[i], train, heldOut, numData, options.Configure)
+			}
+		}()
+	}
+	for i := range candidates {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	best := -1
+	for i := range candidates {
+		if errs[i] != nil {
+			err = errs[i]
+			continue
+		}
+		if best < 0 || report[i].score(options.Criterion) < report[best].score(options.Criterion) {
+			best = i
+		}
+	}
+	for i := range candidates {
+		if i != best && errs[i] == nil {
+			models[i].Delete()
+		}
+	}
+	if err != nil {
+		if best >= 0 {
+			models[best].Delete()
+		}
+		return GMM{}, report, err
+	}
+	return models[best], report, nil
+}
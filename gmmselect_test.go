@@ -0,0 +1,47 @@
+package vlfeat
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSelectGMMRejectsBadOptions(t *testing.T) {
+	train := []float64{0, 1, 2, 3}
+	cases := []struct {
+		name      string
+		dimension uint
+		train     interface{}
+		heldOut   interface{}
+		options   GMMSelectionOptions
+	}{
+		{"null dimension", 0, train, nil, GMMSelectionOptions{MinComponents: 1, MaxComponents: 2}},
+		{"null components", 2, train, nil, GMMSelectionOptions{MaxComponents: 2}},
+		{"empty range", 2, train, nil, GMMSelectionOptions{MinComponents: 3, MaxComponents: 2}},
+		{"missing held-out data", 2, train, nil, GMMSelectionOptions{MinComponents: 1, MaxComponents: 2, Criterion: GMMSelectHeldOut}},
+		{"partial sample", 3, train, nil, GMMSelectionOptions{MinComponents: 1, MaxComponents: 2}},
+		{"empty data", 2, []float64{}, nil, GMMSelectionOptions{MinComponents: 1, MaxComponents: 2}},
+	}
+	for _, c := range cases {
+		if _, _, err := SelectGMM(VlTypeDouble, c.dimension, c.train, c.heldOut, c.options); err == nil {
+			t.Errorf("%s: SelectGMM returned no error", c.name)
+		}
+	}
+}
+
+func TestGMMSelectionResultScore(t *testing.T) {
+	result := GMMSelectionResult{BIC: 10, AIC: 8, HeldOutLogLikelihood: -3}
+	for criterion, want := range map[GMMSelectionCriterion]float64{
+		GMMSelectBIC:     10,
+		GMMSelectAIC:     8,
+		GMMSelectHeldOut: 3,
+	} {
+		if score := result.score(criterion); score != want {
+			t.Errorf("criterion %d: score %g, want %g", criterion, score, want)
+		}
+	}
+	report := GMMSelectionReport{{NumComponents: 4, HeldOutLogLikelihood: math.NaN()}}
+	if lines := strings.Split(strings.TrimSpace(report.String()), "\n"); len(lines) != 2 {
+		t.Errorf("report has %d lines, want a header and one row", len(lines))
+	}
+}
@@ -0,0 +1,317 @@
+package vlfeat
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"math/rand"
+	"sort"
+)
+
+// HammingEmbeddingBits is the length of the binary signatures
+const HammingEmbeddingBits = 64
+
+// HammingEmbedding refines visual words with binary signatures (Jegou et al. 2008).
+// Every word has its own random orthogonal projection to 64 dimensions and the median
+// of every projected dimension over the training descriptors of the word; bit b of a
+// signature is set when projection b is above its median.
+type HammingEmbedding struct {
+	dimension uint
+	numWords  uint
+	// word -> 64 x dimension projection, row by row
+	projections [][]float32
+	// word -> 64 median thresholds
+	thresholds [][HammingEmbeddingBits]float32
+}
+
+// randomProjection returns a 64 x dimension matrix with orthonormal rows, only the
+// first dimension rows are orthogonal when dimension < 64
+func randomProjection(random *rand.Rand, dimension int) []float32 {
+	rows := make([][]float64, HammingEmbeddingBits)
+	projection := make([]float32, HammingEmbeddingBits*dimension)
+	for b := range rows {
+		row := make([]float64, dimension)
+		for d := range row {
+			row[d] = random.NormFloat64()
+		}
+		if b < dimension {
+			for _, previous := range rows[:b] {
+				dot := 0.0
+				for d, v := range previous {
+					dot += v * row[d]
+				}
+				for d, v := range previous {
+					row[d] -= dot * v
+				}
+			}
+		}
+		row = normalizeVector(row)
+		rows[b] = row
+		for d, v := range row {
+			projection[b*dimension+d] = float32(v)
+		}
+	}
+	return projection
+}
+
+func (he *HammingEmbedding) project(descriptor []float32, word uint, out []float32) {
+	D := int(he.dimension)
+	projection := he.projections[word]
+	for b := 0; b < HammingEmbeddingBits; b++ {
+		row := projection[b*D : (b+1)*D]
+		sum := float32(0)
+		for d, v := range row {
+			sum += v * descriptor[d]
+		}
+		out[b] = sum
+	}
+}
+
+// TrainHammingEmbedding learns the projections and thresholds of numWords visual words
+// from N training descriptors of the given dimension, stored row by row, and their
+// visual words as returned by Kmeans.Quantize.
+func TrainHammingEmbedding(descriptors []float32, dimension, N uint, words []uint, numWords uint, seed int64) (HammingEmbedding, error) {
+	if dimension == 0 || numWords == 0 {
+		return HammingEmbedding{}, errors.New("dimension and numWords must be positive")
+	}
+	if len(descriptors) < int(N*dimension) || len(words) < int(N) {
+		return HammingEmbedding{}, errors.New("descriptors must hold N x dimension values and words N values")
+	}
+	he := HammingEmbedding{
+		dimension:   dimension,
+		numWords:    numWords,
+		projections: make([][]float32, numWords),
+		thresholds:  make([][HammingEmbeddingBits]float32, numWords),
+	}
+	random := rand.New(rand.NewSource(seed))
+	for w := range he.projections {
+		he.projections[w] = randomProjection(random, int(dimension))
+	}
+
+	members := make([][]int, numWords)
+	for i, word := range words[:N] {
+		if word >= numWords {
+			return HammingEmbedding{}, errors.New("visual word out of range")
+		}
+		members[word] = append(members[word], i)
+	}
+	D := int(dimension)
+	projected := make([]float32, HammingEmbeddingBits)
+	for w, indices := range members {
+		if len(indices) == 0 {
+			continue
+		}
+		values := make([][]float32, HammingEmbeddingBits)
+		for _, i := range indices {
+			he.project(descriptors[i*D:(i+1)*D], uint(w), projected)
+			for b, v := range projected {
+				values[b] = append(values[b], v)
+			}
+		}
+		for b, v := range values {
+			sort.Slice(v, func(i, j int) bool { return v[i] < v[j] })
+			n := len(v)
+			if n%2 == 1 {
+				he.thresholds[w][b] = v[n/2]
+			} else {
+				he.thresholds[w][b] = (v[n/2-1] + v[n/2]) / 2
+			}
+		}
+	}
+	return he, nil
+}
+
+func (he *HammingEmbedding) GetDimension() uint {
+	return he.dimension
+}
+
+func (he *HammingEmbedding) GetNumWords() uint {
+	return he.numWords
+}
+
+// ComputeSignatures returns the signature of each of the N descriptors in its visual word.
+func (he *HammingEmbedding) ComputeSignatures(descriptors []float32, N uint, words []uint) ([]uint64, error) {
+	if len(descriptors) < int(N*he.dimension) || len(words) < int(N) {
+		return nil, errors.New("descriptors must hold N x dimension values and words N values")
+	}
+	D := int(he.dimension)
+	signatures := make([]uint64, N)
+	projected := make([]float32, HammingEmbeddingBits)
+	for i, word := range words[:N] {
+		if word >= he.numWords {
+			return nil, errors.New("visual word out of range")
+		}
+		he.project(descriptors[i*D:(i+1)*D], word, projected)
+		signature := uint64(0)
+		for b, v := range projected {
+			if v > he.thresholds[word][b] {
+				signature |= 1 << uint(b)
+			}
+		}
+		signatures[i] = signature
+	}
+	return signatures, nil
+}
+
+// HammingDistance is the number of different bits of two signatures
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+/* Inverted index */
+
+// HammingIndexOptions control the scoring of a HammingIndex. Two descriptors with the
+// same word match when their signatures differ by at most Threshold bits, and a match
+// weighs exp(-h^2 / Sigma^2) for a Hamming distance h, or 1 when Sigma is negative.
+// Zero values mean a threshold of 24 bits and sigma 16.
+type HammingIndexOptions struct {
+	Threshold int
+	Sigma     float64
+}
+
+type hammingEntry struct {
+	imageID   uint
+	signature uint64
+}
+
+// HammingIndex is an InvertedIndex also storing the signature of every database
+// descriptor. Only descriptors with the same word and close signatures vote.
+type HammingIndex struct {
+	threshold int
+	sigma     float64
+
+	// counts, IDF and TF-IDF norms of the images
+	inverted InvertedIndex
+	// word -> entries of the descriptors quantized to the word
+	postings [][]hammingEntry
+}
+
+// NewHammingIndex returns an empty index over numWords visual words.
+func NewHammingIndex(numWords uint, options HammingIndexOptions) HammingIndex {
+	if options.Threshold == 0 {
+		options.Threshold = 24
+	}
+	if options.Sigma == 0 {
+		options.Sigma = 16
+	}
+	return HammingIndex{
+		threshold: options.Threshold,
+		sigma:     options.Sigma,
+		inverted:  NewInvertedIndex(numWords),
+		postings:  make([][]hammingEntry, numWords),
+	}
+}
+
+// GetInvertedIndex returns the inverted index of the image words, to search without
+// signatures or to expand queries. Images must be added and removed through the
+// HammingIndex.
+func (index *HammingIndex) GetInvertedIndex() *InvertedIndex {
+	return &index.inverted
+}
+
+func (index *HammingIndex) weight(distance int) float64 {
+	if index.sigma < 0 {
+		return 1
+	}
+	h := float64(distance)
+	return math.Exp(-h * h / (index.sigma * index.sigma))
+}
+
+/* Manage the database */
+
+// Add indexes image id from the words and signatures of its descriptors, replacing
+// the image if it exists.
+func (index *HammingIndex) Add(id uint, words []uint, signatures []uint64) error {
+	if len(words) == 0 || len(words) != len(signatures) {
+		return errors.New("words and signatures must have the same non zero length")
+	}
+	for _, word := range words {
+		if word >= index.inverted.numWords {
+			return errors.New("visual word out of range")
+		}
+	}
+	index.Remove(id)
+	if err := index.inverted.Add(id, words); err != nil {
+		return err
+	}
+	for i, word := range words {
+		index.postings[word] = append(index.postings[word], hammingEntry{imageID: id, signature: signatures[i]})
+	}
+	return nil
+}
+
+// Remove removes image id from the index, it returns false if it was not indexed.
+func (index *HammingIndex) Remove(id uint) bool {
+	counts, ok := index.inverted.images[id]
+	if !ok {
+		return false
+	}
+	for word := range counts {
+		entries := index.postings[word][:0]
+		for _, entry := range index.postings[word] {
+			if entry.imageID != id {
+				entries = append(entries, entry)
+			}
+		}
+		index.postings[word] = entries
+	}
+	return index.inverted.Remove(id)
+}
+
+func (index *HammingIndex) GetNumImages() uint {
+	return index.inverted.GetNumImages()
+}
+
+/* Search */
+
+// Search scores the database images against the words and signatures of the query
+// descriptors and returns the topK best matches (all of them when topK is 0), best
+// first. Every matching pair adds idf^2 times its weight, and the score is normalized
+// by the TF-IDF norms of the query and the image.
+func (index *HammingIndex) Search(words []uint, signatures []uint64, topK int) ([]RetrievalMatch, error) {
+	if len(words) != len(signatures) {
+		return nil, errors.New("words and signatures must have the same length")
+	}
+	inverted := &index.inverted
+	if len(words) == 0 || len(inverted.images) == 0 {
+		return []RetrievalMatch{}, nil
+	}
+	inverted.updateNorms()
+	counts := map[uint]float64{}
+	for _, word := range words {
+		if word < inverted.numWords {
+			counts[word]++
+		}
+	}
+	queryNorm := 0.0
+	for word, count := range counts {
+		w := count * inverted.idf(word)
+		queryNorm += w * w
+	}
+	if queryNorm == 0 {
+		return []RetrievalMatch{}, nil
+	}
+	queryNorm = math.Sqrt(queryNorm)
+
+	scores := map[uint]float64{}
+	for i, word := range words {
+		if word >= inverted.numWords {
+			continue
+		}
+		idf := inverted.idf(word)
+		if idf == 0 {
+			continue
+		}
+		for _, entry := range index.postings[word] {
+			distance := HammingDistance(signatures[i], entry.signature)
+			if distance > index.threshold {
+				continue
+			}
+			scores[entry.imageID] += idf * idf * index.weight(distance)
+		}
+	}
+	for id := range scores {
+		scores[id] /= queryNorm * inverted.norms[id]
+	}
+	return sortRetrievalMatches(scores, topK), nil
+}
@@ -0,0 +1,115 @@
+package vlfeat
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestRandomProjectionOrthonormal(t *testing.T) {
+	const D = 80
+	projection := randomProjection(rand.New(rand.NewSource(1)), D)
+	for a := 0; a < HammingEmbeddingBits; a++ {
+		for b := 0; b <= a; b++ {
+			dot := 0.0
+			for d := 0; d < D; d++ {
+				dot += float64(projection[a*D+d]) * float64(projection[b*D+d])
+			}
+			want := 0.0
+			if a == b {
+				want = 1
+			}
+			if math.Abs(dot-want) > 1e-5 {
+				t.Fatalf("rows %d and %d: dot product %g, want %g", a, b, dot, want)
+			}
+		}
+	}
+}
+
+func TestHammingEmbeddingMedians(t *testing.T) {
+	const D, N = 16, 1002
+	random := rand.New(rand.NewSource(1))
+	descriptors := make([]float32, D*N)
+	for i := range descriptors {
+		descriptors[i] = float32(random.NormFloat64())
+	}
+	words := make([]uint, N)
+	for i := range words {
+		words[i] = uint(i % 2)
+	}
+	he, err := TrainHammingEmbedding(descriptors, D, N, words, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatures, err := he.ComputeSignatures(descriptors, N, words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every bit splits the 501 training descriptors of each word at the median
+	for w := uint(0); w < 2; w++ {
+		for b := 0; b < HammingEmbeddingBits; b++ {
+			set, total := 0, 0
+			for i, word := range words {
+				if word == w {
+					total++
+					set += int(signatures[i] >> uint(b) & 1)
+				}
+			}
+			if set != total/2 {
+				t.Fatalf("word %d bit %d is set for %d of %d descriptors", w, b, set, total)
+			}
+		}
+	}
+
+	// a slightly perturbed descriptor keeps most bits, another descriptor does not
+	perturbed := append([]float32{}, descriptors[:D]...)
+	for d := range perturbed {
+		perturbed[d] += float32(0.01 * random.NormFloat64())
+	}
+	nearby, _ := he.ComputeSignatures(perturbed, 1, words[:1])
+	if h := HammingDistance(nearby[0], signatures[0]); h > 4 {
+		t.Errorf("perturbed descriptor is %d bits away", h)
+	}
+	if h := HammingDistance(signatures[0], signatures[2]); h < 16 {
+		t.Errorf("unrelated descriptors are only %d bits away", h)
+	}
+
+	if _, err := he.ComputeSignatures(descriptors, 1, []uint{2}); err == nil {
+		t.Error("ComputeSignatures accepted a word out of range")
+	}
+	if _, err := TrainHammingEmbedding(descriptors, D, N, []uint{5}, 2, 1); err == nil {
+		t.Error("TrainHammingEmbedding accepted too few words")
+	}
+}
+
+func TestHammingIndexSearch(t *testing.T) {
+	index := NewHammingIndex(4, HammingIndexOptions{Threshold: 8, Sigma: -1})
+	// images 1 and 2 share word 0 with the query, only image 2 with a close signature
+	index.Add(1, []uint{0, 1}, []uint64{math.MaxUint64, 0})
+	index.Add(2, []uint{0, 2}, []uint64{0x0f, 0})
+	index.Add(3, []uint{3}, []uint64{0})
+	matches, err := index.Search([]uint{0}, []uint64{0x07}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].ImageID != 2 {
+		t.Fatalf("matches = %v, want image 2 only", matches)
+	}
+	// the score is the cosine of the TF-IDF vectors restricted to the close pairs
+	idf := math.Log(3.0 / 2)
+	idf2 := math.Log(3.0)
+	want := idf * idf / (idf * math.Sqrt(idf*idf+idf2*idf2))
+	if math.Abs(matches[0].Score-want) > 1e-12 {
+		t.Errorf("score %g, want %g", matches[0].Score, want)
+	}
+
+	if !index.Remove(2) || index.Remove(2) {
+		t.Error("Remove should succeed once")
+	}
+	if matches, _ := index.Search([]uint{0}, []uint64{0x07}, 0); len(matches) != 0 {
+		t.Errorf("matches = %v after removing image 2", matches)
+	}
+	if index.GetNumImages() != 2 {
+		t.Errorf("%d images, want 2", index.GetNumImages())
+	}
+}
@@ -50,6 +50,10 @@ func (hikm *HIKM) GetMaxNiters() uint {
 	return uint(C.vl_hikm_get_max_niters(hikm.p))
 }
 
+func (hikm *HIKM) GetMethod() VlIKMAlgorithms {
+	return VlIKMAlgorithms(hikm.p.method)
+}
+
 /* Set parameters */
 
 // https://www.vlfeat.org/api/hikmeans_8h.html#a23789e4faee416be030f2a519de096e3
@@ -75,10 +79,12 @@ func (hikm *HIKM) Train(data []uint8, N uint) {
 }
 
 // https://www.vlfeat.org/api/hikmeans_8h.html#aacb98ccf6f8e9cc45dcfda9ca4f648c9
+// asgn holds the path of every datum, depth indices per datum
 func (hikm *HIKM) Push(data []uint8, N uint) []uint {
 	dataPtr := toCUcharArrayPtr(data)
-	asgn := make([]uint, N)
-	cAsgn := make([]C.uint, N)
+	length := N * hikm.GetDepth()
+	asgn := make([]uint, length)
+	cAsgn := make([]C.uint, length)
 	C.vl_hikm_push(hikm.p, &cAsgn[0], dataPtr, C.uint(N))
 	for i, angnData := range cAsgn {
 		asgn[i] = uint(angnData)
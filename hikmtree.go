@@ -0,0 +1,285 @@
+package vlfeat
+
+/*
+#include <stdlib.h>
+#include <hikmeans.h>
+*/
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"unsafe"
+)
+
+var (
+	ikmMagic  = [4]byte{'V', 'L', 'I', 'K'}
+	hikmMagic = [4]byte{'V', 'L', 'H', 'K'}
+)
+
+// HIKMNode is a copy of a node of a HIKM tree. Depth is 0 at the root and Path holds
+// the branch taken at every level to reach the node. Centers holds K centers of M
+// values, Children is empty at the leaves and Children[k] is the subtree of center k.
+type HIKMNode struct {
+	Depth    uint       `json:"depth"`
+	Path     []uint     `json:"path"`
+	K        uint       `json:"k"`
+	Centers  []int      `json:"centers"`
+	Children []HIKMNode `json:"children,omitempty"`
+}
+
+func (node *HIKMNode) IsLeaf() bool {
+	return len(node.Children) == 0
+}
+
+func getHIKMChildren(cNode *C.VlHIKMNode, K uint) []*C.VlHIKMNode {
+	if cNode.children == nil {
+		return nil
+	}
+	return (*[1 << 28]*C.VlHIKMNode)(unsafe.Pointer(cNode.children))[:K:K]
+}
+
+// walkHIKMNode calls fn on the nodes of the subtree in preorder, without their children
+func walkHIKMNode(cNode *C.VlHIKMNode, depth uint, path []uint, fn func(node HIKMNode) error) error {
+	filter := IKM{p: cNode.filter}
+	K := filter.GetK()
+	node := HIKMNode{
+		Depth:   depth,
+		Path:    path,
+		K:       K,
+		Centers: filter.GetCenters(),
+	}
+	if err := fn(node); err != nil {
+		return err
+	}
+	for k, child := range getHIKMChildren(cNode, K) {
+		if child == nil {
+			continue
+		}
+		childPath := append(append([]uint{}, path...), uint(k))
+		if err := walkHIKMNode(child, depth+1, childPath, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Walk calls fn on every node of the trained tree in preorder, Children is left empty.
+// Walk stops at the first error returned by fn.
+func (hikm *HIKM) Walk(fn func(node HIKMNode) error) error {
+	if hikm.p.root == nil {
+		return errors.New("HIKM is not trained")
+	}
+	return walkHIKMNode(hikm.p.root, 0, []uint{}, fn)
+}
+
+func getHIKMNode(cNode *C.VlHIKMNode, depth uint, path []uint) HIKMNode {
+	filter := IKM{p: cNode.filter}
+	K := filter.GetK()
+	node := HIKMNode{
+		Depth:   depth,
+		Path:    path,
+		K:       K,
+		Centers: filter.GetCenters(),
+	}
+	for k, child := range getHIKMChildren(cNode, K) {
+		if child == nil {
+			continue
+		}
+		childPath := append(append([]uint{}, path...), uint(k))
+		node.Children = append(node.Children, getHIKMNode(child, depth+1, childPath))
+	}
+	return node
+}
+
+// GetTree returns a copy of the whole trained tree.
+func (hikm *HIKM) GetTree() (HIKMNode, error) {
+	if hikm.p.root == nil {
+		return HIKMNode{}, errors.New("HIKM is not trained")
+	}
+	return getHIKMNode(hikm.p.root, 0, []uint{}), nil
+}
+
+/* IKM save and load */
+
+func writeCenters(w io.Writer, centers []int) error {
+	data := make([]int32, len(centers))
+	for i, c := range centers {
+		data[i] = int32(c)
+	}
+	return binary.Write(w, binary.LittleEndian, data)
+}
+
+// readCenters reads length centers by chunks of modelChunkSize, see readModelValues
+func readCenters(r io.Reader, length uint) ([]int, error) {
+	if length == 0 || length > 1<<30 {
+		return nil, errors.New("bad model size")
+	}
+	capacity := length
+	if capacity > modelChunkSize {
+		capacity = modelChunkSize
+	}
+	centers := make([]int, 0, capacity)
+	for uint(len(centers)) < length {
+		n := length - uint(len(centers))
+		if n > modelChunkSize {
+			n = modelChunkSize
+		}
+		data := make([]int32, n)
+		if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+			return nil, err
+		}
+		for _, c := range data {
+			centers = append(centers, int(c))
+		}
+	}
+	return centers, nil
+}
+
+// Save writes the IKM centers in a binary format.
+func (ikm *IKM) Save(w io.Writer) error {
+	header := []uint32{
+		ModelVersion,
+		uint32(ikm.GetMethod()),
+		uint32(ikm.GetNdims()),
+		uint32(ikm.GetK()),
+	}
+	if err := binary.Write(w, binary.LittleEndian, ikmMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	return writeCenters(w, ikm.GetCenters())
+}
+
+// LoadIKM reads an IKM written by Save, ready for Push.
+func LoadIKM(r io.Reader) (IKM, error) {
+	header := make([]uint32, 4)
+	if err := readModelHeader(r, ikmMagic, header); err != nil {
+		return IKM{}, err
+	}
+	if header[0] != ModelVersion {
+		return IKM{}, errors.New("unsupported IKM model version")
+	}
+	M, K := uint(header[2]), uint(header[3])
+	if M == 0 || K == 0 || M > (1<<30)/K {
+		return IKM{}, errors.New("bad IKM header")
+	}
+	centers, err := readCenters(r, M*K)
+	if err != nil {
+		return IKM{}, err
+	}
+	ikm := NewIKM(VlIKMAlgorithms(header[1]))
+	ikm.Init(centers, M, K)
+	return ikm, nil
+}
+
+/* HIKM save and load */
+
+// nodes are written in preorder as K, number of children and K x M centers
+func writeHIKMNode(w io.Writer, cNode *C.VlHIKMNode) error {
+	filter := IKM{p: cNode.filter}
+	K := filter.GetK()
+	children := getHIKMChildren(cNode, K)
+	if err := binary.Write(w, binary.LittleEndian, []uint32{uint32(K), uint32(len(children))}); err != nil {
+		return err
+	}
+	if err := writeCenters(w, filter.GetCenters()); err != nil {
+		return err
+	}
+	for _, child := range children {
+		if child == nil {
+			return errors.New("HIKM tree has a missing child")
+		}
+		if err := writeHIKMNode(w, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save writes the whole trained tree in a binary format.
+func (hikm *HIKM) Save(w io.Writer) error {
+	if hikm.p.root == nil {
+		return errors.New("HIKM is not trained")
+	}
+	header := []uint32{
+		ModelVersion,
+		uint32(hikm.GetMethod()),
+		uint32(hikm.GetNdims()),
+		uint32(hikm.GetK()),
+		uint32(hikm.GetDepth()),
+	}
+	if err := binary.Write(w, binary.LittleEndian, hikmMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	return writeHIKMNode(w, hikm.p.root)
+}
+
+// newCHIKMNode allocates a node owning filter with vl_calloc, so that vl_hikm_delete
+// frees it. The children of an inner node are NULL until they are set.
+func newCHIKMNode(filter IKM, inner bool) *C.VlHIKMNode {
+	cNode := (*C.VlHIKMNode)(C.vl_calloc(1, C.size_t(unsafe.Sizeof(C.VlHIKMNode{}))))
+	cNode.filter = filter.p
+	if inner {
+		cNode.children = (**C.VlHIKMNode)(C.vl_calloc(C.size_t(filter.GetK()), C.size_t(unsafe.Sizeof(cNode))))
+	}
+	return cNode
+}
+
+// readHIKMNode reads a subtree into slot
+func readHIKMNode(r io.Reader, slot **C.VlHIKMNode, method VlIKMAlgorithms, M, maxK, height uint) error {
+	sizes := make([]uint32, 2)
+	if err := binary.Read(r, binary.LittleEndian, sizes); err != nil {
+		return err
+	}
+	K, numChildren := uint(sizes[0]), uint(sizes[1])
+	if K == 0 || K > maxK || (numChildren != 0 && numChildren != K) || (numChildren != 0 && height <= 1) {
+		return errors.New("bad HIKM node")
+	}
+	centers, err := readCenters(r, M*K)
+	if err != nil {
+		return err
+	}
+	filter := NewIKM(method)
+	filter.Init(centers, M, K)
+	cNode := newCHIKMNode(filter, numChildren != 0)
+	*slot = cNode
+	if numChildren == 0 {
+		return nil
+	}
+	children := getHIKMChildren(cNode, K)
+	for k := range children {
+		if err := readHIKMNode(r, &children[k], method, M, maxK, height-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadHIKM reads a HIKM written by Save, ready for Push.
+func LoadHIKM(r io.Reader) (HIKM, error) {
+	header := make([]uint32, 5)
+	if err := readModelHeader(r, hikmMagic, header); err != nil {
+		return HIKM{}, err
+	}
+	if header[0] != ModelVersion {
+		return HIKM{}, errors.New("unsupported HIKM model version")
+	}
+	method := VlIKMAlgorithms(header[1])
+	M, K, depth := uint(header[2]), uint(header[3]), uint(header[4])
+	if M == 0 || K == 0 || depth == 0 || M > (1<<30)/K {
+		return HIKM{}, errors.New("bad HIKM header")
+	}
+	hikm := NewHIKM(method)
+	hikm.Init(M, K, depth)
+	if err := readHIKMNode(r, &hikm.p.root, method, M, K, depth); err != nil {
+		hikm.Delete()
+		return HIKM{}, err
+	}
+	return hikm, nil
+}
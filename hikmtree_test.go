@@ -0,0 +1,30 @@
+package vlfeat
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReadCentersTruncated(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := writeCenters(&buffer, []int{-3, 0, 7, 255}); err != nil {
+		t.Fatal(err)
+	}
+	centers, err := readCenters(bytes.NewReader(buffer.Bytes()), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(centers, []int{-3, 0, 7, 255}) {
+		t.Errorf("centers = %v, want [-3 0 7 255]", centers)
+	}
+	allocated := allocatedBy(func() {
+		_, err = readCenters(bytes.NewReader(buffer.Bytes()), 1<<30)
+	})
+	if err == nil {
+		t.Error("readCenters accepted a truncated stream")
+	}
+	if allocated > 16<<20 {
+		t.Errorf("readCenters allocated %d bytes for a truncated stream", allocated)
+	}
+}
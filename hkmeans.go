@@ -0,0 +1,213 @@
+package vlfeat
+
+import "errors"
+
+// HKM is a hierarchical k-means tree over float32 data, the float counterpart of HIKM.
+// Every node is a Kmeans with K centers trained on the data assigned to its parent
+// center; Push returns the path of every datum down to a leaf.
+type HKM struct {
+	distance         VlVectorComparisonType
+	algorithm        VlKMeansAlgorithm
+	maxNumIterations uint
+	M                uint
+	K                uint
+	depth            uint
+	root             *hkmNode
+}
+
+type hkmNode struct {
+	kmeans   Kmeans
+	children []*hkmNode
+}
+
+/* Create and destroy */
+
+// NewHKM returns an untrained tree using distance, VlDistanceL2 or VlDistanceL1.
+func NewHKM(distance VlVectorComparisonType) (HKM, error) {
+	if distance != VlDistanceL2 && distance != VlDistanceL1 {
+		return HKM{}, errors.New("HKM just support VlDistanceL2 and VlDistanceL1")
+	}
+	return HKM{
+		distance:         distance,
+		algorithm:        VlKMeansLloyd,
+		maxNumIterations: 200,
+	}, nil
+}
+
+func deleteHKMNode(node *hkmNode) {
+	if node == nil {
+		return
+	}
+	for _, child := range node.children {
+		deleteHKMNode(child)
+	}
+	node.kmeans.Delete()
+}
+
+// Delete frees the Kmeans of every node
+func (hkm *HKM) Delete() {
+	deleteHKMNode(hkm.root)
+	hkm.root = nil
+}
+
+/* Retrieve data and parameters */
+
+func (hkm *HKM) GetNdims() uint {
+	return hkm.M
+}
+
+func (hkm *HKM) GetK() uint {
+	return hkm.K
+}
+
+func (hkm *HKM) GetDepth() uint {
+	return hkm.depth
+}
+
+func (hkm *HKM) GetDistance() VlVectorComparisonType {
+	return hkm.distance
+}
+
+func (hkm *HKM) GetAlgorithm() VlKMeansAlgorithm {
+	return hkm.algorithm
+}
+
+func (hkm *HKM) GetMaxNiters() uint {
+	return hkm.maxNumIterations
+}
+
+/* Set parameters */
+
+func (hkm *HKM) SetAlgorithm(algorithm VlKMeansAlgorithm) {
+	hkm.algorithm = algorithm
+}
+
+func (hkm *HKM) SetMaxNiters(maxNiters uint) {
+	hkm.maxNumIterations = maxNiters
+}
+
+/* Process data */
+
+// Init sets the dimension M, the branching factor K and the depth, discarding any trained tree.
+func (hkm *HKM) Init(M, K, depth uint) {
+	hkm.Delete()
+	hkm.M = M
+	hkm.K = K
+	hkm.depth = depth
+}
+
+// trainHKMNode clusters the N data into min(K, N) centers and recurses on every partition
+func (hkm *HKM) trainHKMNode(data []float32, N, height uint) (*hkmNode, error) {
+	K := hkm.K
+	if N < K {
+		K = N
+	}
+	kmeans, err := NewKeans(VlTypeFloat, hkm.distance)
+	if err != nil {
+		return nil, err
+	}
+	node := &hkmNode{kmeans: kmeans}
+	kmeans.SetAlgorithm(hkm.algorithm)
+	kmeans.SetMaxNumIterations(hkm.maxNumIterations)
+	if _, err := kmeans.Cluster(data, hkm.M, N, K); err != nil {
+		deleteHKMNode(node)
+		return nil, err
+	}
+	if height <= 1 {
+		return node, nil
+	}
+
+	assignments, _, err := kmeans.Quantize(data, N)
+	if err != nil {
+		deleteHKMNode(node)
+		return nil, err
+	}
+	M := int(hkm.M)
+	partitions := make([][]float32, K)
+	for i, k := range assignments {
+		partitions[k] = append(partitions[k], data[i*M:(i+1)*M]...)
+	}
+	node.children = make([]*hkmNode, K)
+	for k, partition := range partitions {
+		if len(partition) == 0 {
+			continue
+		}
+		child, err := hkm.trainHKMNode(partition, uint(len(partition)/M), height-1)
+		if err != nil {
+			deleteHKMNode(node)
+			return nil, err
+		}
+		node.children[k] = child
+	}
+	return node, nil
+}
+
+// Train builds the tree from N data of dimension M, stored row by row.
+func (hkm *HKM) Train(data []float32, N uint) error {
+	if hkm.M == 0 || hkm.K == 0 || hkm.depth == 0 {
+		return errors.New("HKM must be initialized with Init before Train")
+	}
+	if N == 0 || len(data) < int(N*hkm.M) {
+		return errors.New("data must hold N x M values")
+	}
+	hkm.Delete()
+	root, err := hkm.trainHKMNode(data[:N*hkm.M], N, hkm.depth)
+	if err != nil {
+		return err
+	}
+	hkm.root = root
+	return nil
+}
+
+// pushHKMNode assigns the data with the given indices to the centers of node at level
+func (hkm *HKM) pushHKMNode(node *hkmNode, data []float32, indices []int, level int, asgn []uint) error {
+	M := int(hkm.M)
+	depth := int(hkm.depth)
+	subset := make([]float32, 0, len(indices)*M)
+	for _, i := range indices {
+		subset = append(subset, data[i*M:(i+1)*M]...)
+	}
+	assignments, _, err := node.kmeans.Quantize(subset, uint(len(indices)))
+	if err != nil {
+		return err
+	}
+	groups := make([][]int, len(node.children))
+	for j, i := range indices {
+		asgn[i*depth+level] = assignments[j]
+		if node.children != nil {
+			groups[assignments[j]] = append(groups[assignments[j]], i)
+		}
+	}
+	for k, group := range groups {
+		if len(group) == 0 || node.children[k] == nil {
+			continue
+		}
+		if err := hkm.pushHKMNode(node.children[k], data, group, level+1, asgn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Push returns the path of each of the N data down the tree, depth indices per datum.
+// Levels below a leaf reached before the full depth (too little training data) are 0.
+func (hkm *HKM) Push(data []float32, N uint) ([]uint, error) {
+	if hkm.root == nil {
+		return nil, errors.New("HKM is not trained")
+	}
+	if len(data) < int(N*hkm.M) {
+		return nil, errors.New("data must hold N x M values")
+	}
+	asgn := make([]uint, N*hkm.depth)
+	if N == 0 {
+		return asgn, nil
+	}
+	indices := make([]int, N)
+	for i := range indices {
+		indices[i] = i
+	}
+	if err := hkm.pushHKMNode(hkm.root, data, indices, 0, asgn); err != nil {
+		return nil, err
+	}
+	return asgn, nil
+}
@@ -0,0 +1,27 @@
+package vlfeat
+
+import "testing"
+
+func TestHKMValidation(t *testing.T) {
+	if _, err := NewHKM(VlDistanceChi2); err == nil {
+		t.Error("NewHKM accepted VlDistanceChi2")
+	}
+	hkm, err := NewHKM(VlDistanceL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hkm.Delete()
+	if err := hkm.Train([]float32{0, 1}, 1); err == nil {
+		t.Error("Train ran before Init")
+	}
+	hkm.Init(2, 3, 2)
+	if hkm.GetNdims() != 2 || hkm.GetK() != 3 || hkm.GetDepth() != 2 {
+		t.Errorf("Init set M %d, K %d, depth %d", hkm.GetNdims(), hkm.GetK(), hkm.GetDepth())
+	}
+	if err := hkm.Train([]float32{0, 1, 2}, 2); err == nil {
+		t.Error("Train accepted fewer than N x M values")
+	}
+	if _, err := hkm.Push([]float32{0, 1}, 1); err == nil {
+		t.Error("Push ran on an untrained tree")
+	}
+}
@@ -18,7 +18,8 @@ const (
 )
 
 type Hog struct {
-	p *C.VlHog
+	p          *C.VlHog
+	transposed bool
 }
 
 // https://www.vlfeat.org/api/hog_8h.html#adb99ad366dbd4ea539a76f48df1dff9c
@@ -28,7 +29,7 @@ func NewHog(variant VlHogVariant, numOrientations uint, transposed bool) Hog {
 		cTransposed = 1
 	}
 	p := C.vl_hog_new(C.VlHogVariant(variant), C.uint(numOrientations), C.int(cTransposed))
-	return Hog{p: p}
+	return Hog{p: p, transposed: transposed}
 }
 
 // https://www.vlfeat.org/api/hog_8h.html#a31692138ce8b6c925bf9cf4761f9dd71
@@ -84,6 +85,9 @@ func (hog *Hog) GetDimension() uint {
 }
 
 // https://www.vlfeat.org/api/hog_8h.html#a807b3e1a41f403eab4b2c22aba5cbbc2
+//
+// The image has width x height glyphs of GetGlyphSize() pixels, row by row, or column
+// by column for a transposed Hog. See RenderGray and RenderTemplate.
 func (hog *Hog) Render(descriptor []float32, width, height uint) []float32 {
 	descriptorPtr := toCFloatArrayPtr(descriptor)
 	glyphSize := hog.GetGlyphSize()
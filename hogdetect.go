@@ -0,0 +1,457 @@
+package vlfeat
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// HogDetection is a detected window in the pixels of the input image
+type HogDetection struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Score  float64 `json:"score"`
+	Scale  float64 `json:"scale"`
+}
+
+// HogTemplate is a linear detector of Width x Height HOG cells. Weights has the
+// layout of Hog.Extract, Width x Height values for each of the Dimension components.
+type HogTemplate struct {
+	Width     uint      `json:"width"`
+	Height    uint      `json:"height"`
+	Dimension uint      `json:"dimension"`
+	Weights   []float32 `json:"weights"`
+	Bias      float64   `json:"bias"`
+}
+
+// HogDetectorOptions configure the features, the training and the detection. Zero
+// values mean VlHogVariantDalalTriggs with 9 orientations, 8 pixel cells, 3 scales per
+// octave, lambda 1e-4, 10 random negatives per negative image, 3 rounds of hard
+// negative mining keeping at most 200 negatives per image each, detection threshold 0
+// and non maximum suppression of the windows overlapping a better one by 0.5. Padding
+// cells let the windows cross the image borders, see HogPyramidOptions. FlipPositives
+// adds the mirrored positive windows to the training set, for symmetric objects.
+type HogDetectorOptions struct {
+	Variant                  VlHogVariant
+	NumOrientations          uint
+	CellSize                 uint
+	NumScalesPerOctave       uint
+	Padding                  uint
+	Lambda                   float64
+	FlipPositives            bool
+	NumRandomNegatives       int
+	NumHardNegativeRounds    int
+	MaxHardNegativesPerImage int
+	Threshold                float64
+	NMSOverlap               float64
+	Seed                     int64
+}
+
+func (options *HogDetectorOptions) setDefaults() {
+	if options.NumOrientations == 0 {
+		options.NumOrientations = 9
+	}
+	if options.CellSize == 0 {
+		options.CellSize = 8
+	}
+	if options.NumScalesPerOctave == 0 {
+		options.NumScalesPerOctave = 3
+	}
+	if options.Lambda == 0 {
+		options.Lambda = 1e-4
+	}
+	if options.NumRandomNegatives == 0 {
+		options.NumRandomNegatives = 10
+	}
+	if options.NumHardNegativeRounds == 0 {
+		options.NumHardNegativeRounds = 3
+	}
+	if options.MaxHardNegativesPerImage == 0 {
+		options.MaxHardNegativesPerImage = 200
+	}
+	if options.NMSOverlap == 0 {
+		options.NMSOverlap = 0.5
+	}
+}
+
+// HogDetector is a sliding window detector scoring a HogTemplate over the HOG
+// features of an image pyramid (Dalal and Triggs 2005).
+type HogDetector struct {
+	Options  HogDetectorOptions `json:"options"`
+	Template HogTemplate        `json:"template"`
+}
+
+/* Features */
+
+// extractHog computes the HOG of an image with the detector settings
+func (detector *HogDetector) extractHog(image HogImage) ([]float32, uint, uint, uint) {
+	options := detector.Options
+	hog := NewHog(options.Variant, options.NumOrientations, false)
+	defer hog.Delete()
+	hog.PutImage(image.Data, image.Width, image.Height, image.NumChannels, options.CellSize)
+	return hog.Extract(), hog.GetWidth(), hog.GetHeight(), hog.GetDimension()
+}
+
+// permutation returns Hog.GetPermutation for the detector settings
+func (detector *HogDetector) permutation() []int {
+	options := detector.Options
+	hog := NewHog(options.Variant, options.NumOrientations, false)
+	defer hog.Delete()
+	return hog.GetPermutation()
+}
+
+// pyramid computes the HOG of the image at the scales where the template fits
+func (detector *HogDetector) pyramid(image HogImage) (HogPyramid, error) {
+	options := detector.Options
+	return NewHogPyramid(image, HogPyramidOptions{
+		Variant:            options.Variant,
+		NumOrientations:    options.NumOrientations,
+		CellSize:           options.CellSize,
+		NumScalesPerOctave: options.NumScalesPerOctave,
+		MinWidth:           detector.Template.Width,
+		MinHeight:          detector.Template.Height,
+		Padding:            options.Padding,
+	})
+}
+
+// window copies the template sized features at cell (x0, y0) of a level
+func (detector *HogDetector) window(level HogPyramidLevel, x0, y0 uint) []float32 {
+	t := detector.Template
+	W, H := level.Width, level.Height
+	window := make([]float32, t.Width*t.Height*t.Dimension)
+	for k := uint(0); k < t.Dimension; k++ {
+		for y := uint(0); y < t.Height; y++ {
+			src := level.Features[k*W*H+(y0+y)*W+x0 : k*W*H+(y0+y)*W+x0+t.Width]
+			copy(window[k*t.Width*t.Height+y*t.Width:], src)
+		}
+	}
+	return window
+}
+
+// convolve returns the (W - Width + 1) x (H - Height + 1) scores of the template at
+// every cell of a level
+func (detector *HogDetector) convolve(level HogPyramidLevel) ([]float64, uint, uint) {
+	t := detector.Template
+	W, H := level.Width, level.Height
+	if W < t.Width || H < t.Height {
+		return nil, 0, 0
+	}
+	numX, numY := W-t.Width+1, H-t.Height+1
+	scores := make([]float64, numX*numY)
+	for i := range scores {
+		scores[i] = t.Bias
+	}
+	for k := uint(0); k < t.Dimension; k++ {
+		plane := level.Features[k*W*H : (k+1)*W*H]
+		for ty := uint(0); ty < t.Height; ty++ {
+			for tx := uint(0); tx < t.Width; tx++ {
+				w := float64(t.Weights[k*t.Width*t.Height+ty*t.Width+tx])
+				if w == 0 {
+					continue
+				}
+				for y := uint(0); y < numY; y++ {
+					row := plane[(y+ty)*W+tx : (y+ty)*W+tx+numX]
+					out := scores[y*numX : (y+1)*numX]
+					for x, v := range row {
+						out[x] += w * float64(v)
+					}
+				}
+			}
+		}
+	}
+	return scores, numX, numY
+}
+
+/* Detection */
+
+func detectionOverlap(a, b HogDetection) float64 {
+	x0 := math.Max(a.X, b.X)
+	y0 := math.Max(a.Y, b.Y)
+	x1 := math.Min(a.X+a.Width, b.X+b.Width)
+	y1 := math.Min(a.Y+a.Height, b.Y+b.Height)
+	if x1 <= x0 || y1 <= y0 {
+		return 0
+	}
+	intersection := (x1 - x0) * (y1 - y0)
+	return intersection / (a.Width*a.Height + b.Width*b.Height - intersection)
+}
+
+// NonMaximumSuppression keeps the detections, best first, that overlap no better kept
+// detection by more than maxOverlap, the intersection over union of their boxes.
+func NonMaximumSuppression(detections []HogDetection, maxOverlap float64) []HogDetection {
+	sorted := append([]HogDetection{}, detections...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Score > sorted[j].Score })
+	kept := []HogDetection{}
+	for _, detection := range sorted {
+		suppressed := false
+		for _, other := range kept {
+			if detectionOverlap(detection, other) > maxOverlap {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, detection)
+		}
+	}
+	return kept
+}
+
+// scoredWindow is a window with its level and cell, used for mining
+type scoredWindow struct {
+	detection HogDetection
+	level     int
+	x, y      uint
+}
+
+// windowHeap is a min-heap of windows by score, keeping the best ones of a scan
+type windowHeap []scoredWindow
+
+func (h windowHeap) Len() int            { return len(h) }
+func (h windowHeap) Less(i, j int) bool  { return h[i].detection.Score < h[j].detection.Score }
+func (h windowHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *windowHeap) Push(x interface{}) { *h = append(*h, x.(scoredWindow)) }
+func (h *windowHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// scan returns the windows scoring at least threshold, only the maxWindows best ones,
+// best first, when maxWindows is positive
+func (detector *HogDetector) scan(pyramid HogPyramid, threshold float64, maxWindows int) []scoredWindow {
+	cellSize := float64(detector.Options.CellSize)
+	t := detector.Template
+	windows := windowHeap{}
+	for l, level := range pyramid.Levels {
+		scores, numX, _ := detector.convolve(level)
+		for i, score := range scores {
+			if score < threshold {
+				continue
+			}
+			if maxWindows > 0 && len(windows) == maxWindows && score <= windows[0].detection.Score {
+				continue
+			}
+			x, y := uint(i)%numX, uint(i)/numX
+			imageX, imageY := pyramid.CellToImage(l, float64(x), float64(y))
+			heap.Push(&windows, scoredWindow{
+				detection: HogDetection{
+					X:      imageX,
+					Y:      imageY,
+					Width:  float64(t.Width) * cellSize / level.Scale,
+					Height: float64(t.Height) * cellSize / level.Scale,
+					Score:  score,
+					Scale:  level.Scale,
+				},
+				level: l,
+				x:     x,
+				y:     y,
+			})
+			if maxWindows > 0 && len(windows) > maxWindows {
+				heap.Pop(&windows)
+			}
+		}
+	}
+	sort.SliceStable(windows, func(i, j int) bool { return windows[i].detection.Score > windows[j].detection.Score })
+	return windows
+}
+
+// Detect scans the template over the pyramid of the image and returns the windows
+// scoring at least Threshold after non maximum suppression, best first.
+func (detector *HogDetector) Detect(image HogImage) ([]HogDetection, error) {
+	if len(detector.Template.Weights) == 0 {
+		return nil, errors.New("HogDetector has no template")
+	}
+	pyramid, err := detector.pyramid(image)
+	if err != nil {
+		return nil, err
+	}
+	windows := detector.scan(pyramid, detector.Options.Threshold, 0)
+	detections := make([]HogDetection, len(windows))
+	for i, window := range windows {
+		detections[i] = window.detection
+	}
+	return NonMaximumSuppression(detections, detector.Options.NMSOverlap), nil
+}
+
+/* Training */
+
+func appendFloat64(data []float64, values []float32) []float64 {
+	for _, v := range values {
+		data = append(data, float64(v))
+	}
+	return data
+}
+
+// negativeWindow is a negative window of the training set, keyed by its position
+type negativeWindow struct {
+	key      negativeKey
+	features []float64
+}
+
+// negativeKey identifies a window of a negative image
+type negativeKey struct {
+	image, level int
+	x, y         uint
+}
+
+// score returns the score of the current template on the features of a window
+func (detector *HogDetector) score(features []float64) float64 {
+	t := detector.Template
+	score := t.Bias
+	for i, w := range t.Weights {
+		score += float64(w) * features[i]
+	}
+	return score
+}
+
+func (detector *HogDetector) train(positives []float64, numPositives int, negatives []negativeWindow) error {
+	t := &detector.Template
+	dimension := t.Width * t.Height * t.Dimension
+	data := make([]float64, 0, len(positives)+len(negatives)*int(dimension))
+	data = append(data, positives...)
+	for _, negative := range negatives {
+		data = append(data, negative.features...)
+	}
+	labels := make([]float64, numPositives+len(negatives))
+	for i := range labels {
+		if i < numPositives {
+			labels[i] = 1
+		} else {
+			labels[i] = -1
+		}
+	}
+	svm, err := NewSvm(VlSvmSolverSdca, data, dimension, uint(len(labels)), labels, detector.Options.Lambda)
+	if err != nil {
+		return err
+	}
+	defer svm.Delete()
+	svm.SetBiasMultiplier(1)
+	svm.Train()
+	t.Weights = toFloat32Slice(svm.GetModel())
+	t.Bias = svm.GetBias()
+	return nil
+}
+
+// TrainHogDetector learns a template of width x height cells from positive windows,
+// images cropped and resized to width x height cells, and negative images containing
+// no object. The first template is trained against random windows of the negative
+// images. Every round then drops the negatives scoring below -1, the margin, adds the
+// MaxHardNegativesPerImage best windows of every negative image scoring above it that
+// are not in the set yet, and trains again. Training stops when no window is added.
+func TrainHogDetector(positives, negatives []HogImage, width, height uint, options HogDetectorOptions) (HogDetector, error) {
+	if len(positives) == 0 || len(negatives) == 0 {
+		return HogDetector{}, errors.New("TrainHogDetector needs positive windows and negative images")
+	}
+	if width == 0 || height == 0 {
+		return HogDetector{}, errors.New("template width and height must be positive")
+	}
+	options.setDefaults()
+	detector := HogDetector{Options: options}
+	t := &detector.Template
+	t.Width, t.Height = width, height
+
+	var permutation []int
+	if options.FlipPositives {
+		permutation = detector.permutation()
+	}
+	positiveData := []float64{}
+	numPositives := 0
+	for _, positive := range positives {
+		features, hogWidth, hogHeight, dimension := detector.extractHog(positive)
+		if hogWidth != width || hogHeight != height {
+			return HogDetector{}, errors.New("positive windows must have width x height cells")
+		}
+		t.Dimension = dimension
+		positiveData = appendFloat64(positiveData, features)
+		numPositives++
+		if permutation != nil {
+			flipped, err := FlipHogFeatures(features, width, height, permutation, false)
+			if err != nil {
+				return HogDetector{}, err
+			}
+			positiveData = appendFloat64(positiveData, flipped)
+			numPositives++
+		}
+	}
+
+	random := rand.New(rand.NewSource(options.Seed))
+	pyramids := make([]HogPyramid, len(negatives))
+	negativeSet := []negativeWindow{}
+	inSet := map[negativeKey]bool{}
+	for i, negative := range negatives {
+		pyramid, err := detector.pyramid(negative)
+		if err != nil {
+			return HogDetector{}, err
+		}
+		pyramids[i] = pyramid
+		if pyramid.GetNumLevels() == 0 {
+			continue
+		}
+		for n := 0; n < options.NumRandomNegatives; n++ {
+			l := random.Intn(pyramid.GetNumLevels())
+			level := pyramid.Levels[l]
+			key := negativeKey{
+				image: i,
+				level: l,
+				x:     uint(random.Intn(int(level.Width - width + 1))),
+				y:     uint(random.Intn(int(level.Height - height + 1))),
+			}
+			if inSet[key] {
+				continue
+			}
+			inSet[key] = true
+			negativeSet = append(negativeSet, negativeWindow{
+				key:      key,
+				features: appendFloat64(nil, detector.window(level, key.x, key.y)),
+			})
+		}
+	}
+	if len(negativeSet) == 0 {
+		return HogDetector{}, errors.New("negative images must be larger than the template")
+	}
+	if err := detector.train(positiveData, numPositives, negativeSet); err != nil {
+		return HogDetector{}, err
+	}
+
+	for round := 0; round < options.NumHardNegativeRounds; round++ {
+		// easy negatives no longer constrain the template
+		kept := negativeSet[:0]
+		for _, negative := range negativeSet {
+			if detector.score(negative.features) >= -1 {
+				kept = append(kept, negative)
+			} else {
+				delete(inSet, negative.key)
+			}
+		}
+		negativeSet = kept
+
+		numMined := 0
+		for i, pyramid := range pyramids {
+			for _, window := range detector.scan(pyramid, -1, options.MaxHardNegativesPerImage) {
+				key := negativeKey{image: i, level: window.level, x: window.x, y: window.y}
+				if inSet[key] {
+					continue
+				}
+				inSet[key] = true
+				negativeSet = append(negativeSet, negativeWindow{
+					key:      key,
+					features: appendFloat64(nil, detector.window(pyramid.Levels[window.level], window.x, window.y)),
+				})
+				numMined++
+			}
+		}
+		if numMined == 0 {
+			break
+		}
+		if err := detector.train(positiveData, numPositives, negativeSet); err != nil {
+			return HogDetector{}, err
+		}
+	}
+	return detector, nil
+}
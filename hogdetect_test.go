@@ -0,0 +1,107 @@
+package vlfeat
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// randomLevel returns a level of random features
+func randomLevel(random *rand.Rand, width, height, dimension uint, scale float64) HogPyramidLevel {
+	features := make([]float32, width*height*dimension)
+	for i := range features {
+		features[i] = float32(random.NormFloat64())
+	}
+	return HogPyramidLevel{Features: features, Width: width, Height: height, Dimension: dimension, Scale: scale}
+}
+
+func newTestHogDetector(random *rand.Rand) HogDetector {
+	detector := HogDetector{Template: HogTemplate{Width: 3, Height: 2, Dimension: 4, Bias: -0.5}}
+	detector.Options.CellSize = 8
+	detector.Template.Weights = make([]float32, 3*2*4)
+	for i := range detector.Template.Weights {
+		detector.Template.Weights[i] = float32(random.NormFloat64())
+	}
+	return detector
+}
+
+func TestHogDetectorConvolve(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	detector := newTestHogDetector(random)
+	level := randomLevel(random, 7, 5, 4, 1)
+	scores, numX, numY := detector.convolve(level)
+	if numX != 5 || numY != 4 || len(scores) != 20 {
+		t.Fatalf("%d x %d scores, want 5 x 4", numX, numY)
+	}
+	// every score is the dot product of the template and the window plus the bias
+	for y := uint(0); y < numY; y++ {
+		for x := uint(0); x < numX; x++ {
+			want := detector.Template.Bias
+			for i, v := range detector.window(level, x, y) {
+				want += float64(detector.Template.Weights[i]) * float64(v)
+			}
+			if math.Abs(scores[y*numX+x]-want) > 1e-5 {
+				t.Errorf("score at (%d, %d) = %g, want %g", x, y, scores[y*numX+x], want)
+			}
+		}
+	}
+	if scores, _, _ := detector.convolve(randomLevel(random, 2, 5, 4, 1)); scores != nil {
+		t.Error("a level narrower than the template was scored")
+	}
+}
+
+func TestHogDetectorScan(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	detector := newTestHogDetector(random)
+	pyramid := HogPyramid{
+		Options: HogPyramidOptions{CellSize: 8},
+		Levels:  []HogPyramidLevel{randomLevel(random, 9, 8, 4, 1), randomLevel(random, 6, 5, 4, 0.5)},
+	}
+	pyramid.Levels[1].Padding = 1
+	all := detector.scan(pyramid, math.Inf(-1), 0)
+	if len(all) != 7*7+4*4 {
+		t.Fatalf("%d windows, want %d", len(all), 7*7+4*4)
+	}
+	for i, window := range all {
+		if i > 0 && window.detection.Score > all[i-1].detection.Score {
+			t.Fatal("windows are not sorted")
+		}
+		x, y := pyramid.CellToImage(window.level, float64(window.x), float64(window.y))
+		scale := pyramid.Levels[window.level].Scale
+		if window.detection.X != x || window.detection.Y != y || window.detection.Width != 24/scale || window.detection.Height != 16/scale {
+			t.Errorf("window %+v has the wrong box", window)
+		}
+	}
+	// the heap keeps the same best windows
+	if best := detector.scan(pyramid, math.Inf(-1), 5); !reflect.DeepEqual(best, all[:5]) {
+		t.Errorf("5 best windows %v, want %v", best, all[:5])
+	}
+	threshold := all[9].detection.Score
+	if above := detector.scan(pyramid, threshold, 0); len(above) != 10 {
+		t.Errorf("%d windows above the threshold, want 10", len(above))
+	}
+}
+
+func TestNonMaximumSuppression(t *testing.T) {
+	box := func(x, y, score float64) HogDetection {
+		return HogDetection{X: x, Y: y, Width: 10, Height: 10, Score: score}
+	}
+	// the first, third and last boxes overlap the best one by 9/11, 1/3 and 0
+	detections := []HogDetection{box(1, 0, 2), box(0, 0, 3), box(5, 0, 1), box(30, 30, 0.5)}
+	if overlap := detectionOverlap(detections[0], detections[1]); math.Abs(overlap-90.0/110) > 1e-12 {
+		t.Errorf("overlap %g, want %g", overlap, 90.0/110)
+	}
+	kept := NonMaximumSuppression(detections, 0.5)
+	if !reflect.DeepEqual(kept, []HogDetection{detections[1], detections[2], detections[3]}) {
+		t.Errorf("kept %v", kept)
+	}
+	kept = NonMaximumSuppression(detections, 0.2)
+	if !reflect.DeepEqual(kept, []HogDetection{detections[1], detections[3]}) {
+		t.Errorf("kept %v with overlap 0.2", kept)
+	}
+	kept = NonMaximumSuppression(detections, 0.95)
+	if len(kept) != 4 || kept[0].Score != 3 || kept[3].Score != 0.5 {
+		t.Errorf("kept %v, want every detection best first", kept)
+	}
+}
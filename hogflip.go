@@ -0,0 +1,68 @@
+package vlfeat
+
+import "errors"
+
+// FlipHogFeatures returns the HOG features of the left-right mirrored image, without
+// computing them again. features has the layout of Hog.Extract for width x height
+// cells and the dimension of the permutation returned by Hog.GetPermutation. When
+// transposed, as for a Hog created transposed, the cells are stored column by column.
+func FlipHogFeatures(features []float32, width, height uint, permutation []int, transposed bool) ([]float32, error) {
+	dimension := uint(len(permutation))
+	if dimension == 0 || uint(len(features)) != width*height*dimension {
+		return nil, errors.New("features must hold width x height cells of the permutation dimension")
+	}
+	for _, k := range permutation {
+		if k < 0 || uint(k) >= dimension {
+			return nil, errors.New("permutation index out of range")
+		}
+	}
+	stride := width * height
+	flipped := make([]float32, len(features))
+	for k := uint(0); k < dimension; k++ {
+		src := features[uint(permutation[k])*stride : (uint(permutation[k])+1)*stride]
+		dst := flipped[k*stride : (k+1)*stride]
+		if transposed {
+			for x := uint(0); x < width; x++ {
+				copy(dst[x*height:(x+1)*height], src[(width-1-x)*height:(width-x)*height])
+			}
+			continue
+		}
+		for y := uint(0); y < height; y++ {
+			row := src[y*width : (y+1)*width]
+			out := dst[y*width : (y+1)*width]
+			for x := range row {
+				out[x] = row[int(width)-1-x]
+			}
+		}
+	}
+	return flipped, nil
+}
+
+// Flip mirrors left-right the features of width x height cells extracted by this Hog
+func (hog *Hog) Flip(features []float32, width, height uint) ([]float32, error) {
+	return FlipHogFeatures(features, width, height, hog.GetPermutation(), hog.transposed)
+}
+
+// Flip returns the template detecting the mirrored objects, permutation being
+// Hog.GetPermutation for the variant and orientations the template was trained with.
+func (template *HogTemplate) Flip(permutation []int) (HogTemplate, error) {
+	if uint(len(permutation)) != template.Dimension {
+		return HogTemplate{}, errors.New("permutation must have the template dimension")
+	}
+	weights, err := FlipHogFeatures(template.Weights, template.Width, template.Height, permutation, false)
+	if err != nil {
+		return HogTemplate{}, err
+	}
+	return HogTemplate{
+		Width:     template.Width,
+		Height:    template.Height,
+		Dimension: template.Dimension,
+		Weights:   weights,
+		Bias:      template.Bias,
+	}, nil
+}
+
+// FlippedTemplate returns the template of the detector mirrored left-right
+func (detector *HogDetector) FlippedTemplate() (HogTemplate, error) {
+	return detector.Template.Flip(detector.permutation())
+}
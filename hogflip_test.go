@@ -0,0 +1,63 @@
+package vlfeat
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestFlipHogFeatures(t *testing.T) {
+	// 3 x 2 cells, component 1 is the mirror of component 0
+	features := []float32{1, 2, 3, 4, 5, 6, 10, 20, 30, 40, 50, 60}
+	flipped, err := FlipHogFeatures(features, 3, 2, []int{1, 0}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(flipped, []float32{30, 20, 10, 60, 50, 40, 3, 2, 1, 6, 5, 4}) {
+		t.Errorf("flipped %v", flipped)
+	}
+	// flipping twice with an involutive permutation gives the features back
+	again, _ := FlipHogFeatures(flipped, 3, 2, []int{1, 0}, false)
+	if !reflect.DeepEqual(again, features) {
+		t.Errorf("flipped twice %v, want %v", again, features)
+	}
+
+	if _, err := FlipHogFeatures(features, 3, 2, []int{0, 2}, false); err == nil {
+		t.Error("FlipHogFeatures accepted a permutation index out of range")
+	}
+	if _, err := FlipHogFeatures(features, 2, 2, []int{1, 0}, false); err == nil {
+		t.Error("FlipHogFeatures accepted features of the wrong size")
+	}
+}
+
+func TestFlippedTemplateScoresMirroredLevel(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	detector := newTestHogDetector(random)
+	permutation := []int{2, 3, 0, 1}
+	flipped, err := detector.Template.Flip(permutation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	level := randomLevel(random, 7, 5, 4, 1)
+	mirrored := level
+	mirrored.Features, _ = FlipHogFeatures(level.Features, 7, 5, permutation, false)
+
+	// the flipped template scores the mirrored level as the template scores the level
+	scores, numX, numY := detector.convolve(level)
+	flippedDetector := HogDetector{Template: flipped}
+	mirroredScores, _, _ := flippedDetector.convolve(mirrored)
+	for y := uint(0); y < numY; y++ {
+		for x := uint(0); x < numX; x++ {
+			want := scores[y*numX+x]
+			got := mirroredScores[y*numX+numX-1-x]
+			if math.Abs(got-want) > 1e-5 {
+				t.Errorf("mirrored score at (%d, %d) = %g, want %g", numX-1-x, y, got, want)
+			}
+		}
+	}
+
+	if _, err := detector.Template.Flip([]int{1, 0}); err == nil {
+		t.Error("Flip accepted a permutation of the wrong dimension")
+	}
+}
@@ -0,0 +1,243 @@
+package vlfeat
+
+import (
+	"errors"
+	"math"
+)
+
+// HogImage is an image as taken by Hog.PutImage: NumChannels planes of Width x Height
+// pixels, x varying fastest.
+type HogImage struct {
+	Data        []float32
+	Width       uint
+	Height      uint
+	NumChannels uint
+}
+
+// HogPyramidOptions configure the levels of a HogPyramid. Zero values mean
+// VlHogVariantDalalTriggs with 9 orientations, 8 pixel cells, 3 scales per octave and
+// levels down to 1 x 1 cell without padding.
+type HogPyramidOptions struct {
+	Variant                           VlHogVariant
+	NumOrientations                   uint
+	UseBilinearOrientationAssignments bool
+	CellSize                          uint
+	NumScalesPerOctave                uint
+	// MinWidth and MinHeight are the smallest level, in cells, before padding
+	MinWidth  uint
+	MinHeight uint
+	// MaxNumLevels limits the number of levels, 0 for no limit
+	MaxNumLevels int
+	// Padding is the number of null cells added on every side of the levels
+	Padding uint
+}
+
+func (options *HogPyramidOptions) setDefaults() {
+	if options.NumOrientations == 0 {
+		options.NumOrientations = 9
+	}
+	if options.CellSize == 0 {
+		options.CellSize = 8
+	}
+	if options.NumScalesPerOctave == 0 {
+		options.NumScalesPerOctave = 3
+	}
+	if options.MinWidth == 0 {
+		options.MinWidth = 1
+	}
+	if options.MinHeight == 0 {
+		options.MinHeight = 1
+	}
+}
+
+// HogPyramidLevel is the HOG of the image resampled by Scale, with the layout of
+// Hog.Extract. Width and Height count the Padding cells on both sides.
+type HogPyramidLevel struct {
+	Features  []float32
+	Width     uint
+	Height    uint
+	Dimension uint
+	Scale     float64
+	Padding   uint
+}
+
+// HogPyramid holds the HOG of an image at scales 2^(-i / NumScalesPerOctave)
+type HogPyramid struct {
+	Options HogPyramidOptions
+	Levels  []HogPyramidLevel
+}
+
+// resizeImage resamples every channel bilinearly by scale, keeping the
+// floor(Width scale) x floor(Height scale) pixels that fall in the image, so that both
+// axes are scaled by exactly scale
+func resizeImage(image HogImage, scale float64) HogImage {
+	W, H := int(image.Width), int(image.Height)
+	w, h := int(float64(W)*scale), int(float64(H)*scale)
+	resized := HogImage{
+		Data:        make([]float32, w*h*int(image.NumChannels)),
+		Width:       uint(w),
+		Height:      uint(h),
+		NumChannels: image.NumChannels,
+	}
+	sx, sy := 1/scale, 1/scale
+	for c := 0; c < int(image.NumChannels); c++ {
+		src := image.Data[c*W*H : (c+1)*W*H]
+		dst := resized.Data[c*w*h : (c+1)*w*h]
+		for y := 0; y < h; y++ {
+			fy := math.Max((float64(y)+0.5)*sy-0.5, 0)
+			y0 := int(fy)
+			if y0 > H-1 {
+				y0 = H - 1
+			}
+			y1 := y0 + 1
+			if y1 > H-1 {
+				y1 = H - 1
+			}
+			ay := float32(fy - float64(y0))
+			for x := 0; x < w; x++ {
+				fx := math.Max((float64(x)+0.5)*sx-0.5, 0)
+				x0 := int(fx)
+				if x0 > W-1 {
+					x0 = W - 1
+				}
+				x1 := x0 + 1
+				if x1 > W-1 {
+					x1 = W - 1
+				}
+				ax := float32(fx - float64(x0))
+				top := src[y0*W+x0]*(1-ax) + src[y0*W+x1]*ax
+				bottom := src[y1*W+x0]*(1-ax) + src[y1*W+x1]*ax
+				dst[y*w+x] = top*(1-ay) + bottom*ay
+			}
+		}
+	}
+	return resized
+}
+
+// halveImage downsamples every channel by 2, averaging blocks of 2 x 2 pixels so that
+// the coarser octaves do not alias. Odd sizes repeat the last column or row, so that
+// every pixel covers 2 x 2 input pixels and the scale is exactly 1/2.
+func halveImage(image HogImage) HogImage {
+	W, H := int(image.Width), int(image.Height)
+	w, h := (W+1)/2, (H+1)/2
+	halved := HogImage{
+		Data:        make([]float32, w*h*int(image.NumChannels)),
+		Width:       uint(w),
+		Height:      uint(h),
+		NumChannels: image.NumChannels,
+	}
+	for c := 0; c < int(image.NumChannels); c++ {
+		src := image.Data[c*W*H : (c+1)*W*H]
+		dst := halved.Data[c*w*h : (c+1)*w*h]
+		for y := 0; y < h; y++ {
+			y0, y1 := 2*y, 2*y+1
+			if y1 == H {
+				y1 = y0
+			}
+			for x := 0; x < w; x++ {
+				x0, x1 := 2*x, 2*x+1
+				if x1 == W {
+					x1 = x0
+				}
+				dst[y*w+x] = 0.25 * (src[y0*W+x0] + src[y0*W+x1] + src[y1*W+x0] + src[y1*W+x1])
+			}
+		}
+	}
+	return halved
+}
+
+// padFeatures surrounds every component plane with padding null cells
+func padFeatures(features []float32, width, height, dimension, padding uint) []float32 {
+	if padding == 0 {
+		return features
+	}
+	W, H := width+2*padding, height+2*padding
+	padded := make([]float32, W*H*dimension)
+	for k := uint(0); k < dimension; k++ {
+		for y := uint(0); y < height; y++ {
+			copy(padded[k*W*H+(y+padding)*W+padding:], features[k*width*height+y*width:k*width*height+(y+1)*width])
+		}
+	}
+	return padded
+}
+
+// NewHogPyramid computes the HOG of image at scales 1, 2^(-1/NumScalesPerOctave), ...
+// while the level holds at least MinWidth x MinHeight cells. Every octave is the
+// previous one downsampled by 2 with a box filter, and its levels are resampled from
+// it by factors in (1/2, 1], so that no level aliases. Levels are cropped rather than
+// stretched to whole pixels, so that Scale holds exactly on both axes.
+func NewHogPyramid(image HogImage, options HogPyramidOptions) (HogPyramid, error) {
+	if image.Width == 0 || image.Height == 0 || image.NumChannels == 0 {
+		return HogPyramid{}, errors.New("image must not be empty")
+	}
+	if len(image.Data) < int(image.Width*image.Height*image.NumChannels) {
+		return HogPyramid{}, errors.New("image data must hold Width x Height x NumChannels values")
+	}
+	options.setDefaults()
+	hog := NewHog(options.Variant, options.NumOrientations, false)
+	defer hog.Delete()
+	hog.SetUseBilinearOrientationAssignments(options.UseBilinearOrientationAssignments)
+
+	pyramid := HogPyramid{Options: options}
+	octave := image
+	for i := 0; options.MaxNumLevels <= 0 || i < options.MaxNumLevels; i++ {
+		step := i % int(options.NumScalesPerOctave)
+		if i > 0 && step == 0 {
+			if octave.Width < 2 || octave.Height < 2 {
+				break
+			}
+			octave = halveImage(octave)
+		}
+		scale := math.Pow(2, -float64(i)/float64(options.NumScalesPerOctave))
+		octaveScale := math.Pow(2, -float64(step)/float64(options.NumScalesPerOctave))
+		width := uint(float64(octave.Width) * octaveScale)
+		height := uint(float64(octave.Height) * octaveScale)
+		if width/options.CellSize < options.MinWidth || height/options.CellSize < options.MinHeight {
+			break
+		}
+		resized := octave
+		if step > 0 {
+			resized = resizeImage(octave, octaveScale)
+		}
+		hog.PutImage(resized.Data, resized.Width, resized.Height, resized.NumChannels, options.CellSize)
+		hogWidth, hogHeight, dimension := hog.GetWidth(), hog.GetHeight(), hog.GetDimension()
+		pyramid.Levels = append(pyramid.Levels, HogPyramidLevel{
+			Features:  padFeatures(hog.Extract(), hogWidth, hogHeight, dimension, options.Padding),
+			Width:     hogWidth + 2*options.Padding,
+			Height:    hogHeight + 2*options.Padding,
+			Dimension: dimension,
+			Scale:     scale,
+			Padding:   options.Padding,
+		})
+	}
+	return pyramid, nil
+}
+
+func (pyramid *HogPyramid) GetNumLevels() int {
+	return len(pyramid.Levels)
+}
+
+// CellToImage returns the pixel of the original image at the top left corner of the
+// cell (x, y) of a level, padding included.
+func (pyramid *HogPyramid) CellToImage(level int, x, y float64) (float64, float64) {
+	l := pyramid.Levels[level]
+	cellSize := float64(pyramid.Options.CellSize)
+	return (x - float64(l.Padding)) * cellSize / l.Scale, (y - float64(l.Padding)) * cellSize / l.Scale
+}
+
+// ImageToCell is the inverse of CellToImage
+func (pyramid *HogPyramid) ImageToCell(level int, x, y float64) (float64, float64) {
+	l := pyramid.Levels[level]
+	cellSize := float64(pyramid.Options.CellSize)
+	return x*l.Scale/cellSize + float64(l.Padding), y*l.Scale/cellSize + float64(l.Padding)
+}
+
+// GetCell returns the Dimension components of the cell (x, y) of a level
+func (pyramid *HogPyramid) GetCell(level int, x, y uint) []float32 {
+	l := pyramid.Levels[level]
+	cell := make([]float32, l.Dimension)
+	for k := range cell {
+		cell[k] = l.Features[uint(k)*l.Width*l.Height+y*l.Width+x]
+	}
+	return cell
+}
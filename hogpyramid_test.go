@@ -0,0 +1,88 @@
+package vlfeat
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHalveImageOddSize(t *testing.T) {
+	image := HogImage{
+		Data: []float32{
+			0, 4, 8, 12, 16,
+			4, 8, 12, 16, 20,
+			8, 12, 16, 20, 24,
+		},
+		Width:       5,
+		Height:      3,
+		NumChannels: 1,
+	}
+	halved := halveImage(image)
+	if halved.Width != 3 || halved.Height != 2 {
+		t.Fatalf("halved to %d x %d, want 3 x 2", halved.Width, halved.Height)
+	}
+	// the last column and row are repeated
+	want := []float32{4, 12, 18, 10, 18, 24}
+	if !reflect.DeepEqual(halved.Data, want) {
+		t.Errorf("halved = %v, want %v", halved.Data, want)
+	}
+}
+
+func TestResizeImageExactScale(t *testing.T) {
+	// a ramp f(x, y) = x + 100 y, resampled by scale s, holds f at ((x + 0.5) / s - 0.5, ...)
+	W, H := 37, 23
+	image := HogImage{Data: make([]float32, W*H), Width: uint(W), Height: uint(H), NumChannels: 1}
+	for y := 0; y < H; y++ {
+		for x := 0; x < W; x++ {
+			image.Data[y*W+x] = float32(x + 100*y)
+		}
+	}
+	for _, scale := range []float64{math.Pow(2, -1.0/3), math.Pow(2, -2.0/3)} {
+		resized := resizeImage(image, scale)
+		if resized.Width != uint(float64(W)*scale) || resized.Height != uint(float64(H)*scale) {
+			t.Fatalf("scale %g: resized to %d x %d", scale, resized.Width, resized.Height)
+		}
+		w := int(resized.Width)
+		for y := 0; y < int(resized.Height); y++ {
+			for x := 0; x < w; x++ {
+				sx := math.Max((float64(x)+0.5)/scale-0.5, 0)
+				sy := math.Max((float64(y)+0.5)/scale-0.5, 0)
+				want := math.Min(sx, float64(W-1)) + 100*math.Min(sy, float64(H-1))
+				if got := float64(resized.Data[y*w+x]); math.Abs(got-want) > 1e-3 {
+					t.Fatalf("scale %g: pixel (%d, %d) = %g, want %g", scale, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestPadFeatures(t *testing.T) {
+	// 2 planes of 2 x 1 cells padded by 1
+	padded := padFeatures([]float32{1, 2, 3, 4}, 2, 1, 2, 1)
+	want := []float32{
+		0, 0, 0, 0,
+		0, 1, 2, 0,
+		0, 0, 0, 0,
+
+		0, 0, 0, 0,
+		0, 3, 4, 0,
+		0, 0, 0, 0,
+	}
+	if !reflect.DeepEqual(padded, want) {
+		t.Errorf("padded = %v, want %v", padded, want)
+	}
+}
+
+func TestHogPyramidCellToImage(t *testing.T) {
+	pyramid := HogPyramid{
+		Options: HogPyramidOptions{CellSize: 8},
+		Levels:  []HogPyramidLevel{{Scale: 1}, {Scale: 0.5, Padding: 2}},
+	}
+	x, y := pyramid.CellToImage(1, 3, 2)
+	if x != 16 || y != 0 {
+		t.Errorf("cell (3, 2) of level 1 maps to (%g, %g), want (16, 0)", x, y)
+	}
+	if cx, cy := pyramid.ImageToCell(1, x, y); cx != 3 || cy != 2 {
+		t.Errorf("ImageToCell(CellToImage(3, 2)) = (%g, %g)", cx, cy)
+	}
+}
@@ -0,0 +1,158 @@
+package vlfeat
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+// glyphPixel returns the pixel (x, y) of an image rendered by the Hog
+func (hog *Hog) glyphPixel(rendered []float32, imgWidth, imgHeight, x, y uint) float32 {
+	if hog.transposed {
+		return rendered[x*imgHeight+y]
+	}
+	return rendered[y*imgWidth+x]
+}
+
+// transposeHogFeatures turns features of width x height cells stored row by row into
+// the column by column layout of a transposed Hog
+func transposeHogFeatures(features []float32, width, height, dimension uint) []float32 {
+	stride := width * height
+	transposed := make([]float32, len(features))
+	for k := uint(0); k < dimension; k++ {
+		src := features[k*stride : (k+1)*stride]
+		dst := transposed[k*stride : (k+1)*stride]
+		for y := uint(0); y < height; y++ {
+			for x := uint(0); x < width; x++ {
+				dst[x*height+y] = src[y*width+x]
+			}
+		}
+	}
+	return transposed
+}
+
+func maxFloat32(values []float32) float32 {
+	var max float32
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// RenderGray renders the descriptor of width x height cells as glyphs, the largest
+// value white.
+func (hog *Hog) RenderGray(descriptor []float32, width, height uint) (*image.Gray, error) {
+	if width == 0 || height == 0 {
+		return nil, errors.New("descriptor must have at least one cell")
+	}
+	if uint(len(descriptor)) != width*height*hog.GetDimension() {
+		return nil, errors.New("descriptor must hold width x height cells of dimension values")
+	}
+	rendered := hog.Render(descriptor, width, height)
+	glyphSize := hog.GetGlyphSize()
+	imgWidth, imgHeight := width*glyphSize, height*glyphSize
+	gray := image.NewGray(image.Rect(0, 0, int(imgWidth), int(imgHeight)))
+	max := maxFloat32(rendered)
+	if max == 0 {
+		return gray, nil
+	}
+	for y := uint(0); y < imgHeight; y++ {
+		for x := uint(0); x < imgWidth; x++ {
+			v := hog.glyphPixel(rendered, imgWidth, imgHeight, x, y) / max
+			if v < 0 {
+				v = 0
+			}
+			gray.Pix[int(y)*gray.Stride+int(x)] = uint8(v*255 + 0.5)
+		}
+	}
+	return gray, nil
+}
+
+// RenderTemplate renders the weights of a template as a heatmap, the glyphs of the
+// positive weights in red and of the negative weights in blue. The Hog must have the
+// variant and orientations the template was trained with. Templates are stored row by
+// row, as extracted by a Hog that is not transposed, whatever the Hog rendering them.
+func (hog *Hog) RenderTemplate(template HogTemplate) (*image.RGBA, error) {
+	if template.Width == 0 || template.Height == 0 {
+		return nil, errors.New("template must have at least one cell")
+	}
+	if template.Dimension != hog.GetDimension() || uint(len(template.Weights)) != template.Width*template.Height*template.Dimension {
+		return nil, errors.New("template does not match the Hog dimension")
+	}
+	weights := template.Weights
+	if hog.transposed {
+		weights = transposeHogFeatures(weights, template.Width, template.Height, template.Dimension)
+	}
+	positive := make([]float32, len(weights))
+	negative := make([]float32, len(weights))
+	for i, w := range weights {
+		if w > 0 {
+			positive[i] = w
+		} else {
+			negative[i] = -w
+		}
+	}
+	renderedPositive := hog.Render(positive, template.Width, template.Height)
+	renderedNegative := hog.Render(negative, template.Width, template.Height)
+	max := maxFloat32(renderedPositive)
+	if m := maxFloat32(renderedNegative); m > max {
+		max = m
+	}
+
+	glyphSize := hog.GetGlyphSize()
+	imgWidth, imgHeight := template.Width*glyphSize, template.Height*glyphSize
+	heatmap := image.NewRGBA(image.Rect(0, 0, int(imgWidth), int(imgHeight)))
+	for y := uint(0); y < imgHeight; y++ {
+		for x := uint(0); x < imgWidth; x++ {
+			var r, b uint8
+			if max > 0 {
+				r = uint8(hog.glyphPixel(renderedPositive, imgWidth, imgHeight, x, y)/max*255 + 0.5)
+				b = uint8(hog.glyphPixel(renderedNegative, imgWidth, imgHeight, x, y)/max*255 + 0.5)
+			}
+			heatmap.SetRGBA(int(x), int(y), color.RGBA{R: r, B: b, A: 255})
+		}
+	}
+	return heatmap, nil
+}
+
+// OverlayImage blends overlay, stretched to the bounds of source, over source with
+// opacity alpha in [0, 1]. A rendering of the HOG of an image with cells of cellSize
+// pixels covers its top left GetWidth() cellSize x GetHeight() cellSize pixels, the
+// source should be cropped to them.
+func OverlayImage(source, overlay image.Image, alpha float64) (*image.RGBA, error) {
+	if alpha < 0 || alpha > 1 {
+		return nil, errors.New("alpha must be in [0, 1]")
+	}
+	bounds := source.Bounds()
+	blended := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(blended, blended.Bounds(), source, bounds.Min, draw.Src)
+	overlayBounds := overlay.Bounds()
+	if bounds.Empty() || overlayBounds.Empty() {
+		return blended, nil
+	}
+	for y := 0; y < bounds.Dy(); y++ {
+		oy := overlayBounds.Min.Y + y*overlayBounds.Dy()/bounds.Dy()
+		for x := 0; x < bounds.Dx(); x++ {
+			ox := overlayBounds.Min.X + x*overlayBounds.Dx()/bounds.Dx()
+			o := color.RGBAModel.Convert(overlay.At(ox, oy)).(color.RGBA)
+			s := blended.RGBAAt(x, y)
+			blended.SetRGBA(x, y, color.RGBA{
+				R: uint8(float64(s.R)*(1-alpha) + float64(o.R)*alpha + 0.5),
+				G: uint8(float64(s.G)*(1-alpha) + float64(o.G)*alpha + 0.5),
+				B: uint8(float64(s.B)*(1-alpha) + float64(o.B)*alpha + 0.5),
+				A: s.A,
+			})
+		}
+	}
+	return blended, nil
+}
+
+// SavePNG writes the image, such as a rendering, as PNG
+func SavePNG(w io.Writer, img image.Image) error {
+	return png.Encode(w, img)
+}
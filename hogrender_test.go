@@ -0,0 +1,83 @@
+package vlfeat
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+func TestTransposeHogFeatures(t *testing.T) {
+	// 2 planes of 3 x 2 cells
+	features := []float32{
+		1, 2, 3,
+		4, 5, 6,
+
+		7, 8, 9,
+		10, 11, 12,
+	}
+	want := []float32{
+		1, 4, 2, 5, 3, 6,
+		7, 10, 8, 11, 9, 12,
+	}
+	if transposed := transposeHogFeatures(features, 3, 2, 2); !reflect.DeepEqual(transposed, want) {
+		t.Errorf("transposed = %v, want %v", transposed, want)
+	}
+
+	// flipping commutes with the change of layout
+	permutation := []int{1, 0}
+	flipped, err := FlipHogFeatures(features, 3, 2, permutation, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flippedTransposed, err := FlipHogFeatures(want, 3, 2, permutation, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(transposeHogFeatures(flipped, 3, 2, 2), flippedTransposed) {
+		t.Errorf("flipping the transposed layout gives %v, want %v", flippedTransposed, transposeHogFeatures(flipped, 3, 2, 2))
+	}
+}
+
+func TestOverlayImage(t *testing.T) {
+	source := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range source.Pix {
+		source.Pix[i] = 200
+	}
+	// a 2 x 2 overlay stretched over the 4 x 4 source, white on its left column
+	overlay := image.NewGray(image.Rect(0, 0, 2, 2))
+	overlay.SetGray(0, 0, color.Gray{Y: 255})
+	overlay.SetGray(0, 1, color.Gray{Y: 255})
+	blended, err := OverlayImage(source, overlay, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			want := uint8(100)
+			if x < 2 {
+				want = 228
+			}
+			if c := blended.RGBAAt(x, y); c.R != want || c.G != want || c.B != want || c.A != 200 {
+				t.Fatalf("pixel (%d, %d) = %v, want gray %d with the source alpha", x, y, c, want)
+			}
+		}
+	}
+	if _, err := OverlayImage(source, overlay, 2); err == nil {
+		t.Error("OverlayImage accepted alpha 2")
+	}
+
+	var buffer bytes.Buffer
+	if err := SavePNG(&buffer, blended); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bounds() != blended.Bounds() {
+		t.Errorf("decoded bounds %v, want %v", decoded.Bounds(), blended.Bounds())
+	}
+}
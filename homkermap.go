@@ -0,0 +1,146 @@
+package vlfeat
+
+/*
+#include <stdlib.h>
+#include <homkermap.h>
+
+static void vl_homogeneouskernelmap_evaluate_batch_d(VlHomogeneousKernelMap const * self, double * destination, double const * source, vl_size n)
+{
+	vl_size dimension = vl_homogeneouskernelmap_get_dimension(self);
+	vl_size i;
+	for (i = 0; i < n; ++i) {
+		vl_homogeneouskernelmap_evaluate_d(self, destination + i * dimension, 1, source[i]);
+	}
+}
+
+static void vl_homogeneouskernelmap_evaluate_batch_f(VlHomogeneousKernelMap const * self, float * destination, float const * source, vl_size n)
+{
+	vl_size dimension = vl_homogeneouskernelmap_get_dimension(self);
+	vl_size i;
+	for (i = 0; i < n; ++i) {
+		vl_homogeneouskernelmap_evaluate_f(self, destination + i * dimension, 1, source[i]);
+	}
+}
+*/
+import "C"
+import "errors"
+
+type VlHomogeneousKernelType int
+
+const (
+	VlHomogeneousKernelIntersection VlHomogeneousKernelType = 0
+	VlHomogeneousKernelChi2         VlHomogeneousKernelType = 1
+	VlHomogeneousKernelJS           VlHomogeneousKernelType = 2
+)
+
+type VlHomogeneousKernelMapWindowType int
+
+const (
+	VlHomogeneousKernelMapWindowUniform     VlHomogeneousKernelMapWindowType = 0
+	VlHomogeneousKernelMapWindowRectangular VlHomogeneousKernelMapWindowType = 1
+)
+
+// HomKerMap is an explicit feature map of an additive homogeneous kernel: every
+// value x of a histogram is expanded to 2 order + 1 values whose dot products
+// approximate the kernel, so that linear classifiers can be trained on the result.
+type HomKerMap struct {
+	p *C.VlHomogeneousKernelMap
+}
+
+// https://www.vlfeat.org/api/homkermap_8h.html
+//
+// gamma is the homogeneity degree, 1 for the standard kernels. A negative period
+// selects the default period for the kernel and order.
+func NewHomKerMap(kernelType VlHomogeneousKernelType, gamma float64, order uint, period float64, windowType VlHomogeneousKernelMapWindowType) (HomKerMap, error) {
+	if gamma <= 0 {
+		return HomKerMap{}, errors.New("gamma must be positive")
+	}
+	p := C.vl_homogeneouskernelmap_new(C.VlHomogeneousKernelType(kernelType), C.double(gamma), C.uint(order), C.double(period), C.VlHomogeneousKernelMapWindowType(windowType))
+	if p == nil {
+		return HomKerMap{}, errors.New("could not create the homogeneous kernel map")
+	}
+	return HomKerMap{p: p}, nil
+}
+
+func (hom *HomKerMap) Delete() {
+	C.vl_homogeneouskernelmap_delete(hom.p)
+}
+
+/* Retrieve data and parameters */
+
+func (hom *HomKerMap) GetOrder() uint {
+	return uint(C.vl_homogeneouskernelmap_get_order(hom.p))
+}
+
+// GetDimension returns the number of values each input value is expanded to, 2 order + 1
+func (hom *HomKerMap) GetDimension() uint {
+	return uint(C.vl_homogeneouskernelmap_get_dimension(hom.p))
+}
+
+func (hom *HomKerMap) GetKernelType() VlHomogeneousKernelType {
+	return VlHomogeneousKernelType(C.vl_homogeneouskernelmap_get_kernel_type(hom.p))
+}
+
+func (hom *HomKerMap) GetWindowType() VlHomogeneousKernelMapWindowType {
+	return VlHomogeneousKernelMapWindowType(C.vl_homogeneouskernelmap_get_window_type(hom.p))
+}
+
+/* Evaluate */
+
+// EvaluateValue returns the expansion of a single value
+func (hom *HomKerMap) EvaluateValue(x float64) []float64 {
+	dimension := hom.GetDimension()
+	cDestination := make([]C.double, dimension)
+	C.vl_homogeneouskernelmap_evaluate_d(hom.p, &cDestination[0], 1, C.double(x))
+	destination := make([]float64, dimension)
+	for i, v := range cDestination {
+		destination[i] = float64(v)
+	}
+	return destination
+}
+
+// Evaluate expands a matrix of histograms of the given dimension, stored row by row.
+// Every row of the result has dimension x GetDimension() values, the expansion of
+// the value j of a histogram being the values j GetDimension() ... (j+1) GetDimension() - 1.
+func (hom *HomKerMap) Evaluate(histograms []float64, dimension uint) ([]float64, error) {
+	if dimension == 0 || len(histograms)%int(dimension) != 0 {
+		return nil, errors.New("histograms must hold a whole number of rows of dimension values")
+	}
+	n := len(histograms)
+	features := make([]float64, n*int(hom.GetDimension()))
+	if n == 0 {
+		return features, nil
+	}
+	cSource := make([]C.double, n)
+	for i, v := range histograms {
+		cSource[i] = C.double(v)
+	}
+	cDestination := make([]C.double, len(features))
+	C.vl_homogeneouskernelmap_evaluate_batch_d(hom.p, &cDestination[0], &cSource[0], C.uint(n))
+	for i, v := range cDestination {
+		features[i] = float64(v)
+	}
+	return features, nil
+}
+
+// EvaluateFloat32 is Evaluate in single precision.
+func (hom *HomKerMap) EvaluateFloat32(histograms []float32, dimension uint) ([]float32, error) {
+	if dimension == 0 || len(histograms)%int(dimension) != 0 {
+		return nil, errors.New("histograms must hold a whole number of rows of dimension values")
+	}
+	n := len(histograms)
+	features := make([]float32, n*int(hom.GetDimension()))
+	if n == 0 {
+		return features, nil
+	}
+	cSource := make([]C.float, n)
+	for i, v := range histograms {
+		cSource[i] = C.float(v)
+	}
+	cDestination := make([]C.float, len(features))
+	C.vl_homogeneouskernelmap_evaluate_batch_f(hom.p, &cDestination[0], &cSource[0], C.uint(n))
+	for i, v := range cDestination {
+		features[i] = float32(v)
+	}
+	return features, nil
+}
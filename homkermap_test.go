@@ -0,0 +1,21 @@
+package vlfeat
+
+import "testing"
+
+func TestNewHomKerMapRejectsGamma(t *testing.T) {
+	for _, gamma := range []float64{0, -1} {
+		if _, err := NewHomKerMap(VlHomogeneousKernelChi2, gamma, 1, -1, VlHomogeneousKernelMapWindowRectangular); err == nil {
+			t.Errorf("NewHomKerMap accepted gamma %g", gamma)
+		}
+	}
+}
+
+func TestHomKerMapEvaluateRejectsPartialRows(t *testing.T) {
+	var hom HomKerMap
+	if _, err := hom.Evaluate(make([]float64, 5), 2); err == nil {
+		t.Error("Evaluate accepted 5 values of dimension 2")
+	}
+	if _, err := hom.EvaluateFloat32(make([]float32, 4), 0); err == nil {
+		t.Error("EvaluateFloat32 accepted dimension 0")
+	}
+}
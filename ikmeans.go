@@ -99,6 +99,10 @@ func (ikm *IKM) GetVerbosity() int {
 	return int(C.vl_ikm_get_verbosity(ikm.p))
 }
 
+func (ikm *IKM) GetMethod() VlIKMAlgorithms {
+	return VlIKMAlgorithms(ikm.p.method)
+}
+
 // https://www.vlfeat.org/api/ikmeans_8h.html#ad1dcf031fd04bdbaf9d389dcd960c953
 func (ikm *IKM) GetMaxNiters() uint {
 	return uint(C.vl_ikm_get_max_niters(ikm.p))
@@ -0,0 +1,451 @@
+package vlfeat
+
+/*
+#include <stdlib.h>
+#include <hikmeans.h>
+*/
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+)
+
+type ByteVectorFormat int
+
+const (
+	// raw uint8 vectors back to back, as VLFeat .bin files
+	ByteVectorRaw ByteVectorFormat = 0
+	// every vector is preceded by its dimension as a little endian int32, as .bvecs files
+	ByteVectorBvecs ByteVectorFormat = 1
+)
+
+// ByteVectorReader reads uint8 descriptors of dimension M in chunks
+type ByteVectorReader struct {
+	r      io.Reader
+	format ByteVectorFormat
+	M      uint
+}
+
+func NewByteVectorReader(r io.Reader, format ByteVectorFormat, M uint) ByteVectorReader {
+	return ByteVectorReader{r: r, format: format, M: M}
+}
+
+// Read returns up to maxN vectors stored row by row and their number. It returns io.EOF
+// when no vector is left.
+func (br *ByteVectorReader) Read(maxN uint) ([]uint8, uint, error) {
+	M := int(br.M)
+	data := make([]uint8, int(maxN)*M)
+	if br.format == ByteVectorRaw {
+		n, err := io.ReadFull(br.r, data)
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, 0, err
+		}
+		if n%M != 0 {
+			return nil, 0, errors.New("stream does not hold a whole number of vectors")
+		}
+		return data[:n], uint(n / M), nil
+	}
+
+	var dimension int32
+	N := 0
+	for ; N < int(maxN); N++ {
+		if err := binary.Read(br.r, binary.LittleEndian, &dimension); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, 0, err
+		}
+		if int(dimension) != M {
+			return nil, 0, errors.New("bvecs vector dimension does not match M")
+		}
+		if _, err := io.ReadFull(br.r, data[N*M:(N+1)*M]); err != nil {
+			return nil, 0, err
+		}
+	}
+	if N == 0 {
+		return nil, 0, io.EOF
+	}
+	return data[:N*M], uint(N), nil
+}
+
+// IKMStreamOptions control TrainIKMStream and TrainHIKMStream. Zero values mean
+// ChunkSize 65536 vectors, SampleSize 100 vectors per center, MaxSampleSize 2^20
+// vectors and NumPasses 1. MaxSampleSize bounds the vectors held in memory: the nodes
+// of a level are trained in batches of MaxSampleSize / SampleSize nodes, each batch
+// with its own passes over the stream.
+type IKMStreamOptions struct {
+	Method        VlIKMAlgorithms
+	ChunkSize     uint
+	SampleSize    uint
+	MaxSampleSize uint
+	NumPasses     uint
+	Seed          int64
+}
+
+// ikmStreamNode is a node of the tree being trained
+type ikmStreamNode struct {
+	ikm      IKM
+	trained  bool
+	children []*ikmStreamNode
+	// the node belongs to the batch being trained
+	inBatch bool
+
+	// sampling pass
+	sample  []uint8
+	numSeen int
+	// refinement passes
+	sums   []int64
+	counts []int64
+}
+
+type ikmStreamTrainer struct {
+	r       io.ReadSeeker
+	format  ByteVectorFormat
+	M, K    uint
+	depth   uint
+	options IKMStreamOptions
+	rand    *rand.Rand
+	root    *ikmStreamNode
+}
+
+// forEachChunk runs fn on every chunk of the stream
+func (t *ikmStreamTrainer) forEachChunk(fn func(data []uint8, N uint) error) error {
+	if _, err := t.r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader := NewByteVectorReader(t.r, t.format, t.M)
+	for {
+		data, N, err := reader.Read(t.options.ChunkSize)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(data, N); err != nil {
+			return err
+		}
+	}
+}
+
+// route pushes the vectors with the given indices down the trained levels and calls fn
+// with the untrained node they reach and their indices
+func (t *ikmStreamTrainer) route(node *ikmStreamNode, data []uint8, indices []int, fn func(node *ikmStreamNode, indices []int)) {
+	if !node.trained {
+		fn(node, indices)
+		return
+	}
+	if node.children == nil {
+		return
+	}
+	M := int(t.M)
+	subset := make([]uint8, 0, len(indices)*M)
+	for _, i := range indices {
+		subset = append(subset, data[i*M:(i+1)*M]...)
+	}
+	assignments := node.ikm.Push(subset, uint(len(indices)))
+	groups := make([][]int, len(node.children))
+	for j, i := range indices {
+		groups[assignments[j]] = append(groups[assignments[j]], i)
+	}
+	for k, group := range groups {
+		if len(group) > 0 {
+			t.route(node.children[k], data, group, fn)
+		}
+	}
+}
+
+func (t *ikmStreamTrainer) forEachRouted(fn func(node *ikmStreamNode, data []uint8, indices []int)) error {
+	return t.forEachChunk(func(data []uint8, N uint) error {
+		indices := make([]int, N)
+		for i := range indices {
+			indices[i] = i
+		}
+		t.route(t.root, data, indices, func(node *ikmStreamNode, indices []int) {
+			fn(node, data, indices)
+		})
+		return nil
+	})
+}
+
+// levelNodes returns the untrained nodes of the next level
+func (t *ikmStreamTrainer) levelNodes(node *ikmStreamNode, nodes []*ikmStreamNode) []*ikmStreamNode {
+	if !node.trained {
+		return append(nodes, node)
+	}
+	for _, child := range node.children {
+		nodes = t.levelNodes(child, nodes)
+	}
+	return nodes
+}
+
+// trainLevel trains the nodes of one level in batches holding at most MaxSampleSize
+// sampled vectors
+func (t *ikmStreamTrainer) trainLevel(nodes []*ikmStreamNode, parentCenters map[*ikmStreamNode][]int) error {
+	batchSize := int(t.options.MaxSampleSize / t.options.SampleSize)
+	if batchSize == 0 {
+		batchSize = 1
+	}
+	for start := 0; start < len(nodes); start += batchSize {
+		end := start + batchSize
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		for _, node := range nodes[start:end] {
+			node.inBatch = true
+		}
+		err := t.trainBatch(nodes[start:end], parentCenters)
+		for _, node := range nodes[start:end] {
+			node.inBatch = false
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trainBatch initializes the nodes of a batch from a reservoir sample and refines
+// them with NumPasses passes of Lloyd iterations over the stream
+func (t *ikmStreamTrainer) trainBatch(nodes []*ikmStreamNode, parentCenters map[*ikmStreamNode][]int) error {
+	M := int(t.M)
+	sampleSize := int(t.options.SampleSize)
+	err := t.forEachRouted(func(node *ikmStreamNode, data []uint8, indices []int) {
+		if !node.inBatch {
+			return
+		}
+		for _, i := range indices {
+			x := data[i*M : (i+1)*M]
+			if node.numSeen < sampleSize {
+				node.sample = append(node.sample, x...)
+			} else if j := t.rand.Intn(node.numSeen + 1); j < sampleSize {
+				copy(node.sample[j*M:(j+1)*M], x)
+			}
+			node.numSeen++
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		node.ikm = NewIKM(t.options.Method)
+		N := uint(len(node.sample) / M)
+		if N == 0 && parentCenters[node] == nil {
+			node.ikm.Delete()
+			return errors.New("stream holds no vector")
+		} else if N == 0 {
+			// no data reached the node, it keeps the center of its parent
+			node.ikm.Init(parentCenters[node], t.M, 1)
+		} else {
+			K := t.K
+			if N < K {
+				K = N
+			}
+			node.ikm.InitRandData(node.sample, t.M, N, K)
+			node.ikm.Train(node.sample, N)
+		}
+		node.sample = nil
+		node.trained = true
+	}
+
+	for pass := uint(0); pass < t.options.NumPasses; pass++ {
+		for _, node := range nodes {
+			K := node.ikm.GetK()
+			node.sums = make([]int64, K*t.M)
+			node.counts = make([]int64, K)
+		}
+		err := t.forEachChunk(func(data []uint8, N uint) error {
+			indices := make([]int, N)
+			for i := range indices {
+				indices[i] = i
+			}
+			t.routeTrained(t.root, data, indices)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			centers := node.ikm.GetCenters()
+			for k, count := range node.counts {
+				if count == 0 {
+					continue
+				}
+				for d := 0; d < M; d++ {
+					centers[k*M+d] = int((node.sums[k*M+d] + count/2) / count)
+				}
+			}
+			node.ikm.Init(centers, t.M, node.ikm.GetK())
+			node.sums = nil
+			node.counts = nil
+		}
+	}
+	return nil
+}
+
+// routeTrained accumulates the vectors into the sums of the nodes of the level being refined
+func (t *ikmStreamTrainer) routeTrained(node *ikmStreamNode, data []uint8, indices []int) {
+	if !node.trained || (node.children == nil && !node.inBatch) {
+		// a node of the level outside the batch
+		return
+	}
+	M := int(t.M)
+	subset := make([]uint8, 0, len(indices)*M)
+	for _, i := range indices {
+		subset = append(subset, data[i*M:(i+1)*M]...)
+	}
+	assignments := node.ikm.Push(subset, uint(len(indices)))
+	if node.sums != nil {
+		for j, k := range assignments {
+			node.counts[k]++
+			for d, v := range subset[j*M : (j+1)*M] {
+				node.sums[int(k)*M+d] += int64(v)
+			}
+		}
+		return
+	}
+	groups := make([][]int, len(node.children))
+	for j, i := range indices {
+		groups[assignments[j]] = append(groups[assignments[j]], i)
+	}
+	for k, group := range groups {
+		if len(group) > 0 {
+			t.routeTrained(node.children[k], data, group)
+		}
+	}
+}
+
+func (t *ikmStreamTrainer) train() error {
+	if t.options.ChunkSize == 0 {
+		t.options.ChunkSize = 65536
+	}
+	if t.options.SampleSize == 0 {
+		t.options.SampleSize = 100 * t.K
+	}
+	if t.options.MaxSampleSize == 0 {
+		t.options.MaxSampleSize = 1 << 20
+	}
+	if t.options.NumPasses == 0 {
+		t.options.NumPasses = 1
+	}
+	t.rand = rand.New(rand.NewSource(t.options.Seed))
+	t.root = &ikmStreamNode{}
+	parentCenters := map[*ikmStreamNode][]int{}
+	for level := uint(0); level < t.depth; level++ {
+		nodes := t.levelNodes(t.root, nil)
+		if err := t.trainLevel(nodes, parentCenters); err != nil {
+			t.delete(t.root)
+			return err
+		}
+		if level+1 == t.depth {
+			break
+		}
+		parentCenters = map[*ikmStreamNode][]int{}
+		for _, node := range nodes {
+			K := int(node.ikm.GetK())
+			centers := node.ikm.GetCenters()
+			node.children = make([]*ikmStreamNode, K)
+			for k := range node.children {
+				child := &ikmStreamNode{}
+				node.children[k] = child
+				parentCenters[child] = centers[k*int(t.M) : (k+1)*int(t.M)]
+			}
+		}
+	}
+	return nil
+}
+
+func (t *ikmStreamTrainer) delete(node *ikmStreamNode) {
+	if node == nil {
+		return
+	}
+	for _, child := range node.children {
+		t.delete(child)
+	}
+	if node.trained {
+		node.ikm.Delete()
+	}
+}
+
+// toC moves the filters of the trained tree into vlfeat HIKM nodes
+func (t *ikmStreamTrainer) toC(node *ikmStreamNode) *C.VlHIKMNode {
+	cNode := newCHIKMNode(node.ikm, node.children != nil)
+	children := getHIKMChildren(cNode, node.ikm.GetK())
+	for k := range children {
+		children[k] = t.toC(node.children[k])
+	}
+	return cNode
+}
+
+// seekableStream returns r if it can seek, the training reading the stream several
+// times, and otherwise a temporary file holding a copy of r, removed by the returned
+// function.
+func seekableStream(r io.Reader) (io.ReadSeeker, func(), error) {
+	if rs, ok := r.(io.ReadSeeker); ok {
+		return rs, func() {}, nil
+	}
+	file, err := ioutil.TempFile("", "vlfeat-ikmstream-")
+	if err != nil {
+		return nil, nil, err
+	}
+	remove := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		remove()
+		return nil, nil, err
+	}
+	return file, remove, nil
+}
+
+// TrainIKMStream trains K centers of dimension M on the uint8 vectors read from r, which
+// may be larger than memory. The centers are initialized on a random sample of the stream
+// and refined with NumPasses passes over it. As the stream is read several times, a
+// reader that is not an io.ReadSeeker is first copied to a temporary file.
+func TrainIKMStream(r io.Reader, format ByteVectorFormat, M, K uint, options IKMStreamOptions) (IKM, error) {
+	if M == 0 || K == 0 {
+		return IKM{}, errors.New("M and K must be positive")
+	}
+	rs, remove, err := seekableStream(r)
+	if err != nil {
+		return IKM{}, err
+	}
+	defer remove()
+	t := ikmStreamTrainer{r: rs, format: format, M: M, K: K, depth: 1, options: options}
+	if err := t.train(); err != nil {
+		return IKM{}, err
+	}
+	return t.root.ikm, nil
+}
+
+// TrainHIKMStream trains a HIKM tree level by level on the uint8 vectors read from r, with
+// a sampling pass and NumPasses refinement passes over the stream for every batch of
+// nodes of a level. A reader that is not an io.ReadSeeker is first copied to a
+// temporary file.
+func TrainHIKMStream(r io.Reader, format ByteVectorFormat, M, K, depth uint, options IKMStreamOptions) (HIKM, error) {
+	if M == 0 || K == 0 || depth == 0 {
+		return HIKM{}, errors.New("M, K and depth must be positive")
+	}
+	rs, remove, err := seekableStream(r)
+	if err != nil {
+		return HIKM{}, err
+	}
+	defer remove()
+	t := ikmStreamTrainer{r: rs, format: format, M: M, K: K, depth: depth, options: options}
+	if err := t.train(); err != nil {
+		return HIKM{}, err
+	}
+	hikm := NewHIKM(options.Method)
+	hikm.Init(M, K, depth)
+	hikm.p.root = t.toC(t.root)
+	return hikm, nil
+}
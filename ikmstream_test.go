@@ -0,0 +1,89 @@
+package vlfeat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestByteVectorReaderRaw(t *testing.T) {
+	br := NewByteVectorReader(bytes.NewReader([]uint8{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}), ByteVectorRaw, 2)
+	for _, want := range [][]uint8{{1, 2, 3, 4, 5, 6, 7, 8}, {9, 10}} {
+		data, N, err := br.Read(4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(data, want) || N != uint(len(want)/2) {
+			t.Errorf("read %v (%d vectors), want %v", data, N, want)
+		}
+	}
+	if _, _, err := br.Read(4); err != io.EOF {
+		t.Errorf("error %v at the end, want io.EOF", err)
+	}
+
+	br = NewByteVectorReader(bytes.NewReader([]uint8{1, 2, 3}), ByteVectorRaw, 2)
+	if _, _, err := br.Read(4); err == nil {
+		t.Error("Read accepted a partial vector")
+	}
+}
+
+func TestByteVectorReaderBvecs(t *testing.T) {
+	var stream bytes.Buffer
+	for _, vector := range [][]uint8{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}} {
+		binary.Write(&stream, binary.LittleEndian, int32(3))
+		stream.Write(vector)
+	}
+	br := NewByteVectorReader(bytes.NewReader(stream.Bytes()), ByteVectorBvecs, 3)
+	data, N, err := br.Read(2)
+	if err != nil || N != 2 || !reflect.DeepEqual(data, []uint8{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("first read %v (%d vectors, error %v)", data, N, err)
+	}
+	data, N, err = br.Read(2)
+	if err != nil || N != 1 || !reflect.DeepEqual(data, []uint8{7, 8, 9}) {
+		t.Errorf("second read %v (%d vectors, error %v)", data, N, err)
+	}
+	if _, _, err := br.Read(2); err != io.EOF {
+		t.Errorf("error %v at the end, want io.EOF", err)
+	}
+
+	br = NewByteVectorReader(bytes.NewReader(stream.Bytes()), ByteVectorBvecs, 4)
+	if _, _, err := br.Read(2); err == nil {
+		t.Error("Read accepted vectors of the wrong dimension")
+	}
+}
+
+func TestSeekableStream(t *testing.T) {
+	seeker := bytes.NewReader([]byte{1, 2, 3})
+	rs, remove, err := seekableStream(seeker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remove()
+	if rs != seeker {
+		t.Error("a seekable reader was copied")
+	}
+
+	// a plain reader is copied to a temporary file that can be read twice
+	rs, remove, err = seekableStream(bytes.NewBuffer([]byte{4, 5, 6}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := rs.(*os.File)
+	for pass := 0; pass < 2; pass++ {
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rs)
+		if err != nil || !reflect.DeepEqual(data, []byte{4, 5, 6}) {
+			t.Errorf("pass %d read %v, error %v", pass, data, err)
+		}
+	}
+	remove()
+	if _, err := os.Stat(file.Name()); !os.IsNotExist(err) {
+		t.Errorf("temporary file %s was not removed", file.Name())
+	}
+}
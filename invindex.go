@@ -0,0 +1,341 @@
+package vlfeat
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+)
+
+var invertedIndexMagic = [4]byte{'V', 'L', 'I', 'F'}
+
+// maxInvertedIndexWords bounds the vocabulary read by LoadInvertedIndex
+const maxInvertedIndexWords = 1 << 24
+
+// RetrievalMatch is a database image scored against a query. Score is the cosine
+// similarity of the TF-IDF vectors, in [0, 1], higher is better.
+type RetrievalMatch struct {
+	ImageID uint    `json:"imageId"`
+	Score   float64 `json:"score"`
+}
+
+// InvertedIndex is an image database keyed by visual word. Images are indexed by the
+// words of their descriptors, as returned by Kmeans.Quantize or IKM.Push, and scored
+// against a query with TF-IDF weighting.
+type InvertedIndex struct {
+	numWords uint
+
+	// word -> image -> number of descriptors of the image quantized to the word
+	postings []map[uint]uint32
+	// image -> word -> number of descriptors
+	images map[uint]map[uint]uint32
+	// image -> L2 norm of its TF-IDF vector, recomputed when the database changes
+	norms map[uint]float64
+	dirty bool
+}
+
+// NewInvertedIndex returns an empty index over numWords visual words.
+func NewInvertedIndex(numWords uint) InvertedIndex {
+	return InvertedIndex{
+		numWords: numWords,
+		postings: make([]map[uint]uint32, numWords),
+		images:   map[uint]map[uint]uint32{},
+		norms:    map[uint]float64{},
+	}
+}
+
+// idf is ln(number of images / number of images containing the word)
+func (index *InvertedIndex) idf(word uint) float64 {
+	n := len(index.postings[word])
+	if n == 0 {
+		return 0
+	}
+	return math.Log(float64(len(index.images)) / float64(n))
+}
+
+func (index *InvertedIndex) updateNorms() {
+	if !index.dirty {
+		return
+	}
+	for id, counts := range index.images {
+		norm := 0.0
+		for word, count := range counts {
+			w := float64(count) * index.idf(word)
+			norm += w * w
+		}
+		index.norms[id] = math.Sqrt(norm)
+	}
+	index.dirty = false
+}
+
+func (index *InvertedIndex) addCounts(id uint, counts map[uint]uint32) {
+	for word, count := range counts {
+		if index.postings[word] == nil {
+			index.postings[word] = map[uint]uint32{}
+		}
+		index.postings[word][id] = count
+	}
+	index.images[id] = counts
+	index.dirty = true
+}
+
+/* Manage the database */
+
+// Add indexes image id from the visual words of its descriptors, replacing the image
+// if it exists.
+func (index *InvertedIndex) Add(id uint, words []uint) error {
+	if len(words) == 0 {
+		return errors.New("image must have at least one visual word")
+	}
+	counts := map[uint]uint32{}
+	for _, word := range words {
+		if word >= index.numWords {
+			return errors.New("visual word out of range")
+		}
+		counts[word]++
+	}
+	index.Remove(id)
+	index.addCounts(id, counts)
+	return nil
+}
+
+// Remove removes image id from the index, it returns false if it was not indexed.
+func (index *InvertedIndex) Remove(id uint) bool {
+	counts, ok := index.images[id]
+	if !ok {
+		return false
+	}
+	for word := range counts {
+		delete(index.postings[word], id)
+		if len(index.postings[word]) == 0 {
+			index.postings[word] = nil
+		}
+	}
+	delete(index.images, id)
+	delete(index.norms, id)
+	index.dirty = true
+	return true
+}
+
+func (index *InvertedIndex) GetNumWords() uint {
+	return index.numWords
+}
+
+func (index *InvertedIndex) GetNumImages() uint {
+	return uint(len(index.images))
+}
+
+// GetImageIDs returns the indexed image ids in increasing order
+func (index *InvertedIndex) GetImageIDs() []uint {
+	ids := make([]uint, 0, len(index.images))
+	for id := range index.images {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// GetDocumentFrequency returns the number of images containing word
+func (index *InvertedIndex) GetDocumentFrequency(word uint) uint {
+	if word >= index.numWords {
+		return 0
+	}
+	return uint(len(index.postings[word]))
+}
+
+/* Search */
+
+// Search scores the database images against the visual words of the query descriptors
+// and returns the topK best matches (all of them when topK is 0), best first. Images
+// sharing no word with the query are not returned.
+func (index *InvertedIndex) Search(words []uint, topK int) []RetrievalMatch {
+	counts := map[uint]float64{}
+	for _, word := range words {
+		if word < index.numWords {
+			counts[word]++
+		}
+	}
+	return index.search(counts, topK)
+}
+
+// search scores the images against a histogram of visual words
+func (index *InvertedIndex) search(counts map[uint]float64, topK int) []RetrievalMatch {
+	if len(counts) == 0 || len(index.images) == 0 {
+		return []RetrievalMatch{}
+	}
+	index.updateNorms()
+	weights := make(map[uint]float64, len(counts))
+	for word, count := range counts {
+		weights[word] = count * index.idf(word)
+	}
+	normalizeWeights(weights)
+	return index.SearchWeights(weights, topK)
+}
+
+// normalizeWeights divides the weights by their L2 norm
+func normalizeWeights(weights map[uint]float64) {
+	norm := 0.0
+	for _, w := range weights {
+		norm += w * w
+	}
+	if norm == 0 {
+		return
+	}
+	norm = math.Sqrt(norm)
+	for word := range weights {
+		weights[word] /= norm
+	}
+}
+
+// GetTFIDF returns the L2 normalized TF-IDF vector of image id, keyed by visual word.
+func (index *InvertedIndex) GetTFIDF(id uint) (map[uint]float64, bool) {
+	counts, ok := index.images[id]
+	if !ok {
+		return nil, false
+	}
+	index.updateNorms()
+	weights := make(map[uint]float64, len(counts))
+	for word, count := range counts {
+		if w := float64(count) * index.idf(word); w != 0 {
+			weights[word] = w / index.norms[id]
+		}
+	}
+	return weights, true
+}
+
+// SearchWeights scores the database images by the dot product of weights, keyed by
+// visual word, with their normalized TF-IDF vectors. Search is SearchWeights with the
+// normalized TF-IDF vector of the query; weights may also be an expanded query or
+// the weights of a linear classifier. Images with a zero score are not returned.
+func (index *InvertedIndex) SearchWeights(weights map[uint]float64, topK int) []RetrievalMatch {
+	if len(index.images) == 0 {
+		return []RetrievalMatch{}
+	}
+	index.updateNorms()
+	scores := map[uint]float64{}
+	for word, weight := range weights {
+		if word >= index.numWords || weight == 0 {
+			continue
+		}
+		idf := index.idf(word)
+		if idf == 0 {
+			continue
+		}
+		for id, imageCount := range index.postings[word] {
+			scores[id] += weight * float64(imageCount) * idf / index.norms[id]
+		}
+	}
+	for id, score := range scores {
+		if score == 0 {
+			delete(scores, id)
+		}
+	}
+	return sortRetrievalMatches(scores, topK)
+}
+
+func sortRetrievalMatches(scores map[uint]float64, topK int) []RetrievalMatch {
+	matches := make([]RetrievalMatch, 0, len(scores))
+	for id, score := range scores {
+		matches = append(matches, RetrievalMatch{ImageID: id, Score: score})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ImageID < matches[j].ImageID
+	})
+	if topK > 0 && len(matches) > topK {
+		matches = matches[:topK]
+	}
+	return matches
+}
+
+/* Save and load */
+
+// Save writes the index in a binary format: the header, then for every image its id as
+// a uint64, its number of distinct words and the (word, count) pairs.
+func (index *InvertedIndex) Save(w io.Writer) error {
+	if index.numWords > maxInvertedIndexWords {
+		return errors.New("too many visual words to save the inverted index")
+	}
+	header := []uint32{
+		ModelVersion,
+		uint32(index.numWords),
+		uint32(len(index.images)),
+	}
+	if err := binary.Write(w, binary.LittleEndian, invertedIndexMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	for _, id := range index.GetImageIDs() {
+		counts := index.images[id]
+		words := make([]uint, 0, len(counts))
+		for word := range counts {
+			words = append(words, word)
+		}
+		sort.Slice(words, func(i, j int) bool { return words[i] < words[j] })
+		if err := binary.Write(w, binary.LittleEndian, uint64(id)); err != nil {
+			return err
+		}
+		data := make([]uint32, 0, 1+2*len(words))
+		data = append(data, uint32(len(words)))
+		for _, word := range words {
+			data = append(data, uint32(word), counts[word])
+		}
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadInvertedIndex reads an index written by Save.
+func LoadInvertedIndex(r io.Reader) (InvertedIndex, error) {
+	header := make([]uint32, 3)
+	if err := readModelHeader(r, invertedIndexMagic, header); err != nil {
+		return InvertedIndex{}, err
+	}
+	if header[0] != ModelVersion {
+		return InvertedIndex{}, errors.New("unsupported inverted index version")
+	}
+	if header[1] > maxInvertedIndexWords {
+		return InvertedIndex{}, errors.New("bad inverted index number of words")
+	}
+	index := NewInvertedIndex(uint(header[1]))
+	var id64 uint64
+	var numWords uint32
+	for i := uint32(0); i < header[2]; i++ {
+		if err := binary.Read(r, binary.LittleEndian, &id64); err != nil {
+			return InvertedIndex{}, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &numWords); err != nil {
+			return InvertedIndex{}, err
+		}
+		id := uint(id64)
+		if uint64(id) != id64 {
+			return InvertedIndex{}, errors.New("inverted index image id does not fit in uint")
+		}
+		if _, ok := index.images[id]; ok {
+			return InvertedIndex{}, errors.New("duplicate inverted index image id")
+		}
+		if numWords == 0 || uint(numWords) > index.numWords {
+			return InvertedIndex{}, errors.New("bad inverted index image")
+		}
+		data := make([]uint32, 2*numWords)
+		if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+			return InvertedIndex{}, err
+		}
+		counts := make(map[uint]uint32, numWords)
+		for j := 0; j < len(data); j += 2 {
+			if uint(data[j]) >= index.numWords || data[j+1] == 0 {
+				return InvertedIndex{}, errors.New("bad inverted index image")
+			}
+			counts[uint(data[j])] = data[j+1]
+		}
+		index.addCounts(id, counts)
+	}
+	return index, nil
+}
@@ -0,0 +1,99 @@
+package vlfeat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func newTestInvertedIndex(t *testing.T) InvertedIndex {
+	index := NewInvertedIndex(8)
+	images := map[uint][]uint{
+		1:       {0, 0, 1, 2},
+		2:       {2, 3, 4},
+		3:       {5, 6, 7},
+		1 << 40: {0, 1, 7},
+	}
+	for id, words := range images {
+		if err := index.Add(id, words); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return index
+}
+
+func TestInvertedIndexSearch(t *testing.T) {
+	index := newTestInvertedIndex(t)
+	matches := index.Search([]uint{0, 0, 1, 2}, 0)
+	if len(matches) != 3 || matches[0].ImageID != 1 || math.Abs(matches[0].Score-1) > 1e-12 {
+		t.Fatalf("matches = %v, want image 1 first with score 1, then two others", matches)
+	}
+	for _, match := range matches {
+		if match.ImageID == 3 {
+			t.Errorf("image 3 shares no word with the query but scored %g", match.Score)
+		}
+	}
+	if top := index.Search([]uint{0, 0, 1, 2}, 1); len(top) != 1 || top[0].ImageID != 1 {
+		t.Errorf("top 1 = %v, want image 1", top)
+	}
+
+	// word 2 is in images 1 and 2 only, its idf is ln(4 / 2)
+	if df := index.GetDocumentFrequency(2); df != 2 {
+		t.Errorf("document frequency of word 2 = %d, want 2", df)
+	}
+	if idf := index.idf(2); math.Abs(idf-math.Log(2)) > 1e-12 {
+		t.Errorf("idf of word 2 = %g, want ln 2", idf)
+	}
+
+	if !index.Remove(1) || index.Remove(1) {
+		t.Error("Remove should succeed once")
+	}
+	for _, match := range index.Search([]uint{0, 0, 1, 2}, 0) {
+		if match.ImageID == 1 {
+			t.Error("removed image 1 is still returned")
+		}
+	}
+	if err := index.Add(9, []uint{8}); err == nil {
+		t.Error("Add accepted a word out of range")
+	}
+}
+
+func TestInvertedIndexSaveLoad(t *testing.T) {
+	index := newTestInvertedIndex(t)
+	var buffer bytes.Buffer
+	if err := index.Save(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadInvertedIndex(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.GetImageIDs(), index.GetImageIDs()) {
+		t.Fatalf("loaded images %v, want %v", loaded.GetImageIDs(), index.GetImageIDs())
+	}
+	query := []uint{0, 1, 7}
+	if !reflect.DeepEqual(loaded.Search(query, 0), index.Search(query, 0)) {
+		t.Errorf("loaded index ranks %v, want %v", loaded.Search(query, 0), index.Search(query, 0))
+	}
+}
+
+func TestLoadInvertedIndexRejectsDuplicateIDs(t *testing.T) {
+	index := NewInvertedIndex(4)
+	if err := index.Add(7, []uint{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if err := index.Save(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	// declare two images and repeat the record of image 7
+	data := buffer.Bytes()
+	record := data[4+3*4:]
+	binary.LittleEndian.PutUint32(data[4+2*4:], 2)
+	data = append(data, record...)
+	if _, err := LoadInvertedIndex(bytes.NewReader(data)); err == nil {
+		t.Error("LoadInvertedIndex accepted a duplicate image id")
+	}
+}
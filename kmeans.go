@@ -7,7 +7,6 @@ package vlfeat
 import "C"
 import (
 	"errors"
-	"reflect"
 	"unsafe"
 )
 
@@ -71,10 +70,10 @@ func (kmeans *Kmeans) Cluster(data interface{}, dimension, numData, numCenters u
 // because distances is float or double,so return double
 func (kmeans *Kmeans) Quantize(data interface{}, numData uint) ([]uint, []float64, error) {
 	distances := make([]float64, numData)
-	cDistances := make([]C.double, numData)
-	distancesPtr := unsafe.Pointer(&cDistances)
-
 	assignments := make([]uint, numData)
+	if numData == 0 {
+		return assignments, distances, nil
+	}
 	cAssignments := make([]C.uint, numData)
 
 	vltype := kmeans.GetDataType()
@@ -82,9 +81,20 @@ func (kmeans *Kmeans) Quantize(data interface{}, numData uint) ([]uint, []float6
 	if err != nil {
 		return assignments, distances, err
 	}
-	C.vl_kmeans_quantize(kmeans.p, &cAssignments[0], distancesPtr, dataPtr, C.uint(numData))
+	if vltype == VlTypeFloat {
+		cDistances := make([]C.float, numData)
+		C.vl_kmeans_quantize(kmeans.p, &cAssignments[0], unsafe.Pointer(&cDistances[0]), dataPtr, C.uint(numData))
+		for i := 0; i < int(numData); i++ {
+			distances[i] = float64(cDistances[i])
+		}
+	} else {
+		cDistances := make([]C.double, numData)
+		C.vl_kmeans_quantize(kmeans.p, &cAssignments[0], unsafe.Pointer(&cDistances[0]), dataPtr, C.uint(numData))
+		for i := 0; i < int(numData); i++ {
+			distances[i] = float64(cDistances[i])
+		}
+	}
 	for i := 0; i < int(numData); i++ {
-		distances[i] = float64(cDistances[i])
 		assignments[i] = uint(cAssignments[i])
 	}
 	return assignments, distances, nil
@@ -230,22 +240,11 @@ func (kmeans *Kmeans) GetEnergy() float64 {
 }
 
 // https://www.vlfeat.org/api/kmeans_8h.html#a05bd0ac3529beeb460c3dcef4f1a594f
+// centers is float or double, so return double
 func (kmeans *Kmeans) GetCenters() []float64 {
-	dimension := kmeans.GetDimension()
-	numCenters := kmeans.GetNumCenters()
-	length := dimension * numCenters
+	length := int(kmeans.GetDimension() * kmeans.GetNumCenters())
 	cCenterPtr := C.vl_kmeans_get_centers(kmeans.p)
-	hdr := reflect.SliceHeader{
-		Data: uintptr(unsafe.Pointer(cCenterPtr)),
-		Len:  int(length),
-		Cap:  int(length),
-	}
-	cCenterSlice := *(*[]C.double)(unsafe.Pointer(&hdr))
-	centers := make([]float64, length)
-	for i, center := range cCenterSlice {
-		centers[i] = float64(center)
-	}
-	return centers
+	return fromCVlTypeArrayPtr(unsafe.Pointer(cCenterPtr), kmeans.GetDataType(), length)
 }
 
 /* Set parameters */
@@ -0,0 +1,362 @@
+package vlfeat
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// DescriptorIterator yields descriptors in batches, stored row by row
+// (numData x dimension). Next returns io.EOF once the data is exhausted and
+// Reset rewinds the iterator so that another pass can start.
+type DescriptorIterator interface {
+	Next() ([]float32, error)
+	Reset() error
+}
+
+// sliceIterator iterates over descriptors that are already in memory
+type sliceIterator struct {
+	data      []float32
+	batchSize int
+	offset    int
+}
+
+// NewSliceIterator returns a DescriptorIterator over data returning batchSize descriptors at a time.
+func NewSliceIterator(data []float32, dimension, batchSize uint) DescriptorIterator {
+	return &sliceIterator{data: data, batchSize: int(dimension * batchSize)}
+}
+
+func (it *sliceIterator) Next() ([]float32, error) {
+	if it.offset >= len(it.data) {
+		return nil, io.EOF
+	}
+	end := it.offset + it.batchSize
+	if end > len(it.data) {
+		end = len(it.data)
+	}
+	batch := it.data[it.offset:end]
+	it.offset = end
+	return batch, nil
+}
+
+func (it *sliceIterator) Reset() error {
+	it.offset = 0
+	return nil
+}
+
+// readerIterator iterates over raw float32 descriptors stored in a file
+type readerIterator struct {
+	r         io.ReadSeeker
+	order     binary.ByteOrder
+	dimension int
+	buf       []byte
+	batch     []float32
+}
+
+// NewReaderIterator returns a DescriptorIterator reading raw float32 descriptors from r,
+// batchSize descriptors at a time. The stream must hold a whole number of descriptors.
+func NewReaderIterator(r io.ReadSeeker, order binary.ByteOrder, dimension, batchSize uint) DescriptorIterator {
+	return &readerIterator{
+		r:         r,
+		order:     order,
+		dimension: int(dimension),
+		buf:       make([]byte, 4*dimension*batchSize),
+		batch:     make([]float32, dimension*batchSize),
+	}
+}
+
+func (it *readerIterator) Next() ([]float32, error) {
+	n, err := io.ReadFull(it.r, it.buf)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if n%(4*it.dimension) != 0 {
+		return nil, errors.New("stream does not hold a whole number of descriptors")
+	}
+	length := n / 4
+	for i := 0; i < length; i++ {
+		it.batch[i] = math.Float32frombits(it.order.Uint32(it.buf[4*i:]))
+	}
+	return it.batch[:length], nil
+}
+
+func (it *readerIterator) Reset() error {
+	_, err := it.r.Seek(0, io.SeekStart)
+	return err
+}
+
+// MiniBatchCheckpoint is the state of a MiniBatchKmeans run, it can be passed to Resume
+// to continue training from where it stopped.
+type MiniBatchCheckpoint struct {
+	Dimension  uint      `json:"dimension"`
+	NumCenters uint      `json:"numCenters"`
+	Pass       uint      `json:"pass"`
+	Batch      uint      `json:"batch"`
+	Energy     float64   `json:"energy"`
+	Centers    []float64 `json:"centers"`
+	Counts     []float64 `json:"counts"`
+	Spreads    []float64 `json:"spreads,omitempty"`
+}
+
+// MiniBatchKmeans trains the centers of a Kmeans on data that does not fit in memory.
+// Each batch is assigned with Kmeans.Quantize, then every center moves towards the
+// descriptors assigned to it with a per-center learning rate 1/count (Sculley, 2010),
+// and the new centers are written back with Kmeans.SetCenters. With VlDistanceL1 the
+// centers track the median of their descriptors with steps scaled by a running mean of
+// the absolute deviation of each dimension, so that the step follows the data scale.
+type MiniBatchKmeans struct {
+	kmeans          *Kmeans
+	l1              bool
+	dimension       uint
+	numCenters      uint
+	maxNumPasses    uint
+	checkpointEvery uint
+	onCheckpoint    func(MiniBatchCheckpoint) error
+	onPass          func(pass uint, energy float64)
+
+	centers []float64
+	counts  []float64
+	spreads []float64
+	pass    uint
+	batch   uint
+	energy  float64
+}
+
+// NewMiniBatchKmeans returns a mini-batch trainer for the centers of kmeans.
+// kmeans must use VlDistanceL2 or VlDistanceL1.
+func NewMiniBatchKmeans(kmeans *Kmeans, dimension, numCenters uint) (MiniBatchKmeans, error) {
+	distance := kmeans.GetDistance()
+	if distance != VlDistanceL2 && distance != VlDistanceL1 {
+		return MiniBatchKmeans{}, errors.New("MiniBatchKmeans just support VlDistanceL2 and VlDistanceL1")
+	}
+	return MiniBatchKmeans{
+		kmeans:       kmeans,
+		l1:           distance == VlDistanceL1,
+		dimension:    dimension,
+		numCenters:   numCenters,
+		maxNumPasses: 1,
+	}, nil
+}
+
+/* Set parameters */
+
+func (mb *MiniBatchKmeans) SetMaxNumPasses(maxNumPasses uint) {
+	mb.maxNumPasses = maxNumPasses
+}
+
+// SetCheckpoint makes Process call fn every `every` batches and at the end of every pass.
+func (mb *MiniBatchKmeans) SetCheckpoint(every uint, fn func(MiniBatchCheckpoint) error) {
+	mb.checkpointEvery = every
+	mb.onCheckpoint = fn
+}
+
+// SetPassCallback makes Process call fn with the energy of each pass once it is finished.
+func (mb *MiniBatchKmeans) SetPassCallback(fn func(pass uint, energy float64)) {
+	mb.onPass = fn
+}
+
+/* Retrieve data and parameters */
+
+func (mb *MiniBatchKmeans) GetMaxNumPasses() uint {
+	return mb.maxNumPasses
+}
+
+// GetPass returns the number of passes already completed.
+func (mb *MiniBatchKmeans) GetPass() uint {
+	return mb.pass
+}
+
+func (mb *MiniBatchKmeans) GetCenters() []float64 {
+	centers := make([]float64, len(mb.centers))
+	copy(centers, mb.centers)
+	return centers
+}
+
+// GetCheckpoint returns a copy of the current training state.
+func (mb *MiniBatchKmeans) GetCheckpoint() MiniBatchCheckpoint {
+	counts := make([]float64, len(mb.counts))
+	copy(counts, mb.counts)
+	var spreads []float64
+	if mb.spreads != nil {
+		spreads = make([]float64, len(mb.spreads))
+		copy(spreads, mb.spreads)
+	}
+	return MiniBatchCheckpoint{
+		Dimension:  mb.dimension,
+		NumCenters: mb.numCenters,
+		Pass:       mb.pass,
+		Batch:      mb.batch,
+		Energy:     mb.energy,
+		Centers:    mb.GetCenters(),
+		Counts:     counts,
+		Spreads:    spreads,
+	}
+}
+
+// Resume restores the state saved in checkpoint and loads its centers into the Kmeans.
+func (mb *MiniBatchKmeans) Resume(checkpoint MiniBatchCheckpoint) error {
+	if checkpoint.Dimension != mb.dimension || checkpoint.NumCenters != mb.numCenters {
+		return errors.New("checkpoint does not match dimension or number of centers")
+	}
+	if len(checkpoint.Centers) != int(mb.dimension*mb.numCenters) || len(checkpoint.Counts) != int(mb.numCenters) {
+		return errors.New("checkpoint centers or counts have the wrong length")
+	}
+	if mb.l1 && len(checkpoint.Spreads) != len(checkpoint.Centers) {
+		return errors.New("checkpoint spreads have the wrong length")
+	}
+	mb.centers = make([]float64, len(checkpoint.Centers))
+	copy(mb.centers, checkpoint.Centers)
+	mb.counts = make([]float64, len(checkpoint.Counts))
+	copy(mb.counts, checkpoint.Counts)
+	mb.spreads = nil
+	if mb.l1 {
+		mb.spreads = make([]float64, len(checkpoint.Spreads))
+		copy(mb.spreads, checkpoint.Spreads)
+	}
+	mb.pass = checkpoint.Pass
+	mb.batch = checkpoint.Batch
+	mb.energy = checkpoint.Energy
+	return mb.kmeans.SetCenters(mb.centers, mb.dimension, mb.numCenters)
+}
+
+/* Process data */
+
+// initCenters seeds the centers from the first batch according to the Kmeans initialization
+func (mb *MiniBatchKmeans) initCenters(batch []float32, numData uint) error {
+	if numData < mb.numCenters {
+		return errors.New("first batch must hold at least numCenters descriptors")
+	}
+	var err error
+	if mb.kmeans.GetInitialization() == VlKMeansPlusPlus {
+		err = mb.kmeans.InitCentersPlusPlus(batch, mb.dimension, numData, mb.numCenters)
+	} else {
+		err = mb.kmeans.InitCentersWithRandData(batch, mb.dimension, numData, mb.numCenters)
+	}
+	if err != nil {
+		return err
+	}
+	mb.centers = mb.kmeans.GetCenters()
+	mb.counts = make([]float64, mb.numCenters)
+	if mb.l1 {
+		mb.spreads = make([]float64, len(mb.centers))
+	}
+	return nil
+}
+
+// Step updates the centers with one batch of descriptors and returns the energy of
+// the batch measured against the centers before the update.
+func (mb *MiniBatchKmeans) Step(batch []float32) (float64, error) {
+	if len(batch) == 0 || len(batch)%int(mb.dimension) != 0 {
+		return 0, errors.New("batch length must be a non-zero multiple of dimension")
+	}
+	numData := uint(len(batch)) / mb.dimension
+	if mb.centers == nil {
+		if err := mb.initCenters(batch, numData); err != nil {
+			return 0, err
+		}
+	}
+	assignments, distances, err := mb.kmeans.Quantize(batch, numData)
+	if err != nil {
+		return 0, err
+	}
+
+	dimension := int(mb.dimension)
+	energy := 0.0
+	for i, k := range assignments {
+		energy += distances[i]
+		mb.update(k, batch[i*dimension:(i+1)*dimension])
+	}
+	if err := mb.kmeans.SetCenters(mb.centers, mb.dimension, mb.numCenters); err != nil {
+		return 0, err
+	}
+	return energy, nil
+}
+
+// update moves center k towards x with the learning rate 1/count
+func (mb *MiniBatchKmeans) update(k uint, x []float32) {
+	dimension := int(mb.dimension)
+	mb.counts[k]++
+	eta := 1 / mb.counts[k]
+	center := mb.centers[int(k)*dimension : (int(k)+1)*dimension]
+	if !mb.l1 {
+		for d := range center {
+			center[d] += eta * (float64(x[d]) - center[d])
+		}
+		return
+	}
+	// stochastic subgradient step towards the median, eta spread sign(diff), where
+	// spread is the running mean absolute deviation; the first descriptor assigned to
+	// a center moves it onto the descriptor
+	spread := mb.spreads[int(k)*dimension : (int(k)+1)*dimension]
+	for d := range center {
+		diff := float64(x[d]) - center[d]
+		spread[d] += eta * (math.Abs(diff) - spread[d])
+		if diff > 0 {
+			center[d] += eta * spread[d]
+		} else if diff < 0 {
+			center[d] -= eta * spread[d]
+		}
+	}
+}
+
+func (mb *MiniBatchKmeans) checkpoint() error {
+	if mb.onCheckpoint == nil {
+		return nil
+	}
+	return mb.onCheckpoint(mb.GetCheckpoint())
+}
+
+// Process runs passes over iter until MaxNumPasses passes have been done and returns
+// the energy of each pass run by this call. A run restored with Resume skips the
+// batches of the current pass that were already processed.
+func (mb *MiniBatchKmeans) Process(iter DescriptorIterator) ([]float64, error) {
+	energies := []float64{}
+	for mb.pass < mb.maxNumPasses {
+		if err := iter.Reset(); err != nil {
+			return energies, err
+		}
+		for i := uint(0); i < mb.batch; i++ {
+			if _, err := iter.Next(); err != nil {
+				return energies, err
+			}
+		}
+		for {
+			batch, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return energies, err
+			}
+			energy, err := mb.Step(batch)
+			if err != nil {
+				return energies, err
+			}
+			mb.energy += energy
+			mb.batch++
+			if mb.checkpointEvery > 0 && mb.batch%mb.checkpointEvery == 0 {
+				if err := mb.checkpoint(); err != nil {
+					return energies, err
+				}
+			}
+		}
+		if mb.batch == 0 {
+			return energies, errors.New("iterator returned no data")
+		}
+		energies = append(energies, mb.energy)
+		if mb.onPass != nil {
+			mb.onPass(mb.pass, mb.energy)
+		}
+		mb.pass++
+		mb.batch = 0
+		mb.energy = 0
+		if err := mb.checkpoint(); err != nil {
+			return energies, err
+		}
+	}
+	return energies, nil
+}
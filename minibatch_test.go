@@ -0,0 +1,49 @@
+package vlfeat
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestMiniBatchKmeansL1TracksMedian(t *testing.T) {
+	// exponential data has its median, ln 2 scale, away from its mean, scale
+	for _, scale := range []float64{1e-3, 1, 255} {
+		mb := MiniBatchKmeans{
+			l1:         true,
+			dimension:  2,
+			numCenters: 1,
+			centers:    []float64{0, 0},
+			counts:     []float64{0},
+			spreads:    []float64{0, 0},
+		}
+		random := rand.New(rand.NewSource(1))
+		for i := 0; i < 100000; i++ {
+			mb.update(0, []float32{
+				float32(scale * random.ExpFloat64()),
+				float32(scale * (1 + random.ExpFloat64())),
+			})
+		}
+		medians := []float64{scale * math.Ln2, scale * (1 + math.Ln2)}
+		for d, median := range medians {
+			if math.Abs(mb.centers[d]-median) > 0.02*scale {
+				t.Errorf("scale %g: center[%d] = %g, want median %g", scale, d, mb.centers[d], median)
+			}
+		}
+	}
+}
+
+func TestMiniBatchKmeansL2TracksMean(t *testing.T) {
+	mb := MiniBatchKmeans{
+		dimension:  1,
+		numCenters: 1,
+		centers:    []float64{0},
+		counts:     []float64{0},
+	}
+	for _, x := range []float32{1, 2, 3, 6} {
+		mb.update(0, []float32{x})
+	}
+	if math.Abs(mb.centers[0]-3) > 1e-12 {
+		t.Errorf("center = %g, want the mean 3", mb.centers[0])
+	}
+}
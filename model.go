@@ -0,0 +1,306 @@
+package vlfeat
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+)
+
+// ModelVersion is the version written by Save and SaveJSON
+const ModelVersion = 1
+
+var (
+	kmeansMagic = [4]byte{'V', 'L', 'K', 'M'}
+	gmmMagic    = [4]byte{'V', 'L', 'G', 'M'}
+)
+
+// KmeansModel is the trained state of a Kmeans
+type KmeansModel struct {
+	Version    int                    `json:"version"`
+	DataType   VlType                 `json:"dataType"`
+	Distance   VlVectorComparisonType `json:"distance"`
+	Dimension  uint                   `json:"dimension"`
+	NumCenters uint                   `json:"numCenters"`
+	Centers    []float64              `json:"centers"`
+}
+
+// GMMModel is the trained state of a GMM, covariances are diagonal
+type GMMModel struct {
+	Version     int       `json:"version"`
+	DataType    VlType    `json:"dataType"`
+	Dimension   uint      `json:"dimension"`
+	NumClusters uint      `json:"numClusters"`
+	Means       []float64 `json:"means"`
+	Covariances []float64 `json:"covariances"`
+	Priors      []float64 `json:"priors"`
+}
+
+/* Kmeans */
+
+func (kmeans *Kmeans) GetModel() KmeansModel {
+	return KmeansModel{
+		Version:    ModelVersion,
+		DataType:   kmeans.GetDataType(),
+		Distance:   kmeans.GetDistance(),
+		Dimension:  kmeans.GetDimension(),
+		NumCenters: kmeans.GetNumCenters(),
+		Centers:    kmeans.GetCenters(),
+	}
+}
+
+// NewKmeansFromModel returns a Kmeans with the centers of model, ready for Quantize.
+func NewKmeansFromModel(model KmeansModel) (Kmeans, error) {
+	if model.Version != ModelVersion {
+		return Kmeans{}, errors.New("unsupported Kmeans model version")
+	}
+	if len(model.Centers) != int(model.Dimension*model.NumCenters) {
+		return Kmeans{}, errors.New("Kmeans model centers have the wrong length")
+	}
+	kmeans, err := NewKeans(model.DataType, model.Distance)
+	if err != nil {
+		return Kmeans{}, err
+	}
+	if err := kmeans.SetCenters(model.Centers, model.Dimension, model.NumCenters); err != nil {
+		kmeans.Delete()
+		return Kmeans{}, err
+	}
+	return kmeans, nil
+}
+
+// Save writes the Kmeans in the binary model format.
+func (kmeans *Kmeans) Save(w io.Writer) error {
+	model := kmeans.GetModel()
+	header := []uint32{
+		uint32(model.Version),
+		uint32(model.DataType),
+		uint32(model.Distance),
+		uint32(model.Dimension),
+		uint32(model.NumCenters),
+	}
+	if err := binary.Write(w, binary.LittleEndian, kmeansMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	return writeModelValues(w, model.DataType, model.Centers)
+}
+
+// LoadKmeans reads a Kmeans written by Save.
+func LoadKmeans(r io.Reader) (Kmeans, error) {
+	header := make([]uint32, 5)
+	if err := readModelHeader(r, kmeansMagic, header); err != nil {
+		return Kmeans{}, err
+	}
+	model := KmeansModel{
+		Version:    int(header[0]),
+		DataType:   VlType(header[1]),
+		Distance:   VlVectorComparisonType(header[2]),
+		Dimension:  uint(header[3]),
+		NumCenters: uint(header[4]),
+	}
+	if model.Version != ModelVersion {
+		return Kmeans{}, errors.New("unsupported Kmeans model version")
+	}
+	centers, err := readModelValues(r, model.DataType, int(model.Dimension*model.NumCenters))
+	if err != nil {
+		return Kmeans{}, err
+	}
+	model.Centers = centers
+	return NewKmeansFromModel(model)
+}
+
+// SaveJSON writes the Kmeans as JSON, suited to small models.
+func (kmeans *Kmeans) SaveJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(kmeans.GetModel())
+}
+
+// LoadKmeansJSON reads a Kmeans written by SaveJSON.
+func LoadKmeansJSON(r io.Reader) (Kmeans, error) {
+	var model KmeansModel
+	if err := json.NewDecoder(r).Decode(&model); err != nil {
+		return Kmeans{}, err
+	}
+	return NewKmeansFromModel(model)
+}
+
+/* GMM */
+
+func (gmm *GMM) GetModel() GMMModel {
+	return GMMModel{
+		Version:     ModelVersion,
+		DataType:    gmm.GetDataType(),
+		Dimension:   gmm.GetDimension(),
+		NumClusters: gmm.GetNumClusters(),
+		Means:       gmm.getMeans(),
+		Covariances: gmm.getCovariances(),
+		Priors:      gmm.getPriors(),
+	}
+}
+
+// NewGMMFromModel returns a GMM with the parameters of model, ready for FisherEncode
+// or as a starting point for Em. Its initialization is VlGMMCustom.
+func NewGMMFromModel(model GMMModel) (GMM, error) {
+	if model.Version != ModelVersion {
+		return GMM{}, errors.New("unsupported GMM model version")
+	}
+	if model.DataType != VlTypeFloat && model.DataType != VlTypeDouble {
+		return GMM{}, errors.New("GMM just support VlTypeFloat and VlTypeDouble")
+	}
+	length := int(model.Dimension * model.NumClusters)
+	if len(model.Means) != length || len(model.Covariances) != length || len(model.Priors) != int(model.NumClusters) {
+		return GMM{}, errors.New("GMM model parameters have the wrong length")
+	}
+	gmm := NewGMM(model.DataType, model.Dimension, model.NumClusters)
+	if err := gmm.InitWithParameters(model.Means, model.Covariances, model.Priors); err != nil {
+		gmm.Delete()
+		return GMM{}, err
+	}
+	return gmm, nil
+}
+
+// InitWithModel seeds the GMM with the parameters of a saved model, so that Em or
+// Cluster warm-start from it on new data.
+func (gmm *GMM) InitWithModel(model GMMModel) error {
+	if model.Dimension != gmm.GetDimension() || model.NumClusters != gmm.GetNumClusters() {
+		return errors.New("GMM model does not match dimension or number of clusters")
+	}
+	length := int(model.Dimension * model.NumClusters)
+	if len(model.Means) != length || len(model.Covariances) != length || len(model.Priors) != int(model.NumClusters) {
+		return errors.New("GMM model parameters have the wrong length")
+	}
+	return gmm.InitWithParameters(model.Means, model.Covariances, model.Priors)
+}
+
+// Save writes the GMM in the binary model format.
+func (gmm *GMM) Save(w io.Writer) error {
+	model := gmm.GetModel()
+	header := []uint32{
+		uint32(model.Version),
+		uint32(model.DataType),
+		uint32(model.Dimension),
+		uint32(model.NumClusters),
+	}
+	if err := binary.Write(w, binary.LittleEndian, gmmMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	for _, values := range [][]float64{model.Means, model.Covariances, model.Priors} {
+		if err := writeModelValues(w, model.DataType, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadGMM reads a GMM written by Save.
+func LoadGMM(r io.Reader) (GMM, error) {
+	header := make([]uint32, 4)
+	if err := readModelHeader(r, gmmMagic, header); err != nil {
+		return GMM{}, err
+	}
+	model := GMMModel{
+		Version:     int(header[0]),
+		DataType:    VlType(header[1]),
+		Dimension:   uint(header[2]),
+		NumClusters: uint(header[3]),
+	}
+	if model.Version != ModelVersion {
+		return GMM{}, errors.New("unsupported GMM model version")
+	}
+	length := int(model.Dimension * model.NumClusters)
+	var err error
+	if model.Means, err = readModelValues(r, model.DataType, length); err != nil {
+		return GMM{}, err
+	}
+	if model.Covariances, err = readModelValues(r, model.DataType, length); err != nil {
+		return GMM{}, err
+	}
+	if model.Priors, err = readModelValues(r, model.DataType, int(model.NumClusters)); err != nil {
+		return GMM{}, err
+	}
+	return NewGMMFromModel(model)
+}
+
+// SaveJSON writes the GMM as JSON, suited to small models.
+func (gmm *GMM) SaveJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(gmm.GetModel())
+}
+
+// LoadGMMJSON reads a GMM written by SaveJSON.
+func LoadGMMJSON(r io.Reader) (GMM, error) {
+	var model GMMModel
+	if err := json.NewDecoder(r).Decode(&model); err != nil {
+		return GMM{}, err
+	}
+	return NewGMMFromModel(model)
+}
+
+/* binary format helpers */
+
+func readModelHeader(r io.Reader, magic [4]byte, header []uint32) error {
+	var m [4]byte
+	if err := binary.Read(r, binary.LittleEndian, &m); err != nil {
+		return err
+	}
+	if m != magic {
+		return errors.New("bad model magic number")
+	}
+	return binary.Read(r, binary.LittleEndian, header)
+}
+
+// values are stored with the precision of the model data type
+func writeModelValues(w io.Writer, dataType VlType, values []float64) error {
+	if dataType == VlTypeFloat {
+		data := make([]float32, len(values))
+		for i, v := range values {
+			data[i] = float32(v)
+		}
+		return binary.Write(w, binary.LittleEndian, data)
+	}
+	return binary.Write(w, binary.LittleEndian, values)
+}
+
+// modelChunkSize is the number of values read at once, so that a loader allocates as
+// much as the stream holds rather than what a truncated or corrupt header declares
+const modelChunkSize = 1 << 16
+
+func readModelValues(r io.Reader, dataType VlType, length int) ([]float64, error) {
+	if length < 0 || length > math.MaxInt32 {
+		return nil, errors.New("bad model size")
+	}
+	if dataType != VlTypeFloat && dataType != VlTypeDouble {
+		return nil, errors.New("model data type must be VlTypeFloat or VlTypeDouble")
+	}
+	capacity := length
+	if capacity > modelChunkSize {
+		capacity = modelChunkSize
+	}
+	values := make([]float64, 0, capacity)
+	for len(values) < length {
+		n := length - len(values)
+		if n > modelChunkSize {
+			n = modelChunkSize
+		}
+		if dataType == VlTypeFloat {
+			data := make([]float32, n)
+			if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+				return nil, err
+			}
+			for _, v := range data {
+				values = append(values, float64(v))
+			}
+			continue
+		}
+		data := make([]float64, n)
+		if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+			return nil, err
+		}
+		values = append(values, data...)
+	}
+	return values, nil
+}
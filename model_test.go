@@ -0,0 +1,77 @@
+package vlfeat
+
+import (
+	"bytes"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestModelValuesRoundTrip(t *testing.T) {
+	values := make([]float64, 3*modelChunkSize+5)
+	for i := range values {
+		values[i] = float64(i) / 4
+	}
+	for _, dataType := range []VlType{VlTypeFloat, VlTypeDouble} {
+		var buffer bytes.Buffer
+		if err := writeModelValues(&buffer, dataType, values); err != nil {
+			t.Fatal(err)
+		}
+		read, err := readModelValues(&buffer, dataType, len(values))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(read, values) {
+			t.Errorf("data type %d: values differ after a round trip", dataType)
+		}
+	}
+}
+
+// allocatedBy returns the bytes allocated by fn
+func allocatedBy(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestReadModelValuesTruncated(t *testing.T) {
+	// a header declaring 1 << 30 doubles followed by 10 of them
+	stream := make([]byte, 80)
+	var err error
+	allocated := allocatedBy(func() {
+		_, err = readModelValues(bytes.NewReader(stream), VlTypeDouble, 1<<30)
+	})
+	if err == nil {
+		t.Error("readModelValues accepted a truncated stream")
+	}
+	if allocated > 16<<20 {
+		t.Errorf("readModelValues allocated %d bytes for a truncated stream", allocated)
+	}
+	if _, err := readModelValues(bytes.NewReader(stream), VlTypeInt32, 2); err == nil {
+		t.Error("readModelValues accepted an integer data type")
+	}
+}
+
+func TestNewGMMFromModelRejectsBadModels(t *testing.T) {
+	valid := GMMModel{
+		Version:     ModelVersion,
+		DataType:    VlTypeDouble,
+		Dimension:   2,
+		NumClusters: 1,
+		Means:       []float64{0, 0},
+		Covariances: []float64{1, 1},
+		Priors:      []float64{1},
+	}
+	bad := []GMMModel{valid, valid, valid, valid}
+	bad[0].Version = ModelVersion + 1
+	bad[1].DataType = VlTypeInt32
+	bad[2].Covariances = []float64{1}
+	bad[3].Priors = nil
+	for i, model := range bad {
+		if _, err := NewGMMFromModel(model); err == nil {
+			t.Errorf("model %d was accepted", i)
+		}
+	}
+}
@@ -0,0 +1,573 @@
+package vlfeat
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+var pcaMagic = [4]byte{'V', 'L', 'P', 'C'}
+
+const (
+	// eigenvalues below pcaEpsilon times the largest one are dropped by FitPCA and
+	// raised to it before whitening
+	pcaEpsilon = 1e-10
+	// subspace iterations of the truncated fit
+	pcaNumIterations = 10
+	// extra dimensions of the subspace of the truncated fit
+	pcaOversampling = 10
+	// size above which FitPCA avoids diagonalizing the covariance or Gram matrix
+	// whenever NumComponents allows the truncated fit
+	pcaMaxJacobiSize = 512
+)
+
+// PCAOptions control FitPCA. NumComponents of 0 keeps all of them. When Whiten is set,
+// component i of a projection is divided by (eigenvalue i + Regularization)^Power,
+// Power 0.5 being full whitening and smaller powers a partial one. Eigenvalues are
+// floored at 1e-10 times the largest one, so that null directions are not amplified.
+// Zero values of Power mean 0.5.
+type PCAOptions struct {
+	NumComponents  uint
+	Whiten         bool
+	Power          float64
+	Regularization float64
+}
+
+// PCAModel is the fitted state of a PCA. Components holds NumComponents rows of
+// Dimension values, by decreasing eigenvalue.
+type PCAModel struct {
+	Version        int       `json:"version"`
+	Dimension      uint      `json:"dimension"`
+	NumComponents  uint      `json:"numComponents"`
+	Whiten         bool      `json:"whiten"`
+	Power          float64   `json:"power"`
+	Regularization float64   `json:"regularization"`
+	Mean           []float64 `json:"mean"`
+	Components     []float64 `json:"components"`
+	Eigenvalues    []float64 `json:"eigenvalues"`
+}
+
+// PCA projects descriptors or encodings on their principal components, for example
+// Sift descriptors before Kmeans or GMM training and the output of VladEncode or
+// FisherEncode before indexing.
+type PCA struct {
+	model PCAModel
+	// 1 / (eigenvalue + regularization)^power, or 1 without whitening
+	scales []float64
+}
+
+/* Fit */
+
+// symmetricEigen diagonalizes the n x n symmetric matrix a, stored row by row, with
+// the cyclic Jacobi method. It returns the eigenvalues by decreasing value and the
+// eigenvectors as the rows of a n x n matrix. Every sweep costs O(n^3).
+func symmetricEigen(a []float64, n int) ([]float64, []float64) {
+	a = append([]float64{}, a...)
+	v := make([]float64, n*n)
+	for i := 0; i < n; i++ {
+		v[i*n+i] = 1
+	}
+	// the off-diagonal mass is compared to the squared Frobenius norm, which rotations
+	// preserve, so that the result does not depend on the scale of a
+	norm := 0.0
+	for _, x := range a {
+		norm += x * x
+	}
+	const epsilon = 2.220446049250313e-16
+	for sweep := 0; sweep < 100; sweep++ {
+		off := 0.0
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				off += a[p*n+q] * a[p*n+q]
+			}
+		}
+		if off <= epsilon*epsilon*norm {
+			break
+		}
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				apq := a[p*n+q]
+				if apq == 0 {
+					continue
+				}
+				theta := (a[q*n+q] - a[p*n+p]) / (2 * apq)
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < n; k++ {
+					akp, akq := a[k*n+p], a[k*n+q]
+					a[k*n+p] = c*akp - s*akq
+					a[k*n+q] = s*akp + c*akq
+				}
+				for k := 0; k < n; k++ {
+					apk, aqk := a[p*n+k], a[q*n+k]
+					a[p*n+k] = c*apk - s*aqk
+					a[q*n+k] = s*apk + c*aqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := v[k*n+p], v[k*n+q]
+					v[k*n+p] = c*vkp - s*vkq
+					v[k*n+q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return a[order[i]*n+order[i]] > a[order[j]*n+order[j]] })
+	eigenvalues := make([]float64, n)
+	eigenvectors := make([]float64, n*n)
+	for i, k := range order {
+		eigenvalues[i] = a[k*n+k]
+		for j := 0; j < n; j++ {
+			eigenvectors[i*n+j] = v[j*n+k]
+		}
+	}
+	return eigenvalues, eigenvectors
+}
+
+// truncatedEigen returns the k leading eigenvalues and eigenvectors of the covariance
+// X^T X / (n-1) of the n x D centered data X by subspace iteration, without forming
+// the covariance: every iteration costs O(n D (k + pcaOversampling)).
+func truncatedEigen(centered []float64, n, D, k int) ([]float64, []float64) {
+	l := k + pcaOversampling
+	random := rand.New(rand.NewSource(0))
+	// Q holds l orthonormal rows of D values
+	Q := make([]float64, l*D)
+	for i := range Q {
+		Q[i] = random.NormFloat64()
+	}
+	orthonormalizeRows(Q, l, D)
+	Y := make([]float64, n*l)
+	project := func() {
+		// Y = X Q^T
+		for i := 0; i < n; i++ {
+			x := centered[i*D : (i+1)*D]
+			for j := 0; j < l; j++ {
+				q := Q[j*D : (j+1)*D]
+				dot := 0.0
+				for d, v := range x {
+					dot += v * q[d]
+				}
+				Y[i*l+j] = dot
+			}
+		}
+	}
+	for iteration := 0; iteration < pcaNumIterations; iteration++ {
+		project()
+		// Q = (X^T Y)^T
+		for i := range Q {
+			Q[i] = 0
+		}
+		for i := 0; i < n; i++ {
+			x := centered[i*D : (i+1)*D]
+			for j := 0; j < l; j++ {
+				y := Y[i*l+j]
+				if y == 0 {
+					continue
+				}
+				q := Q[j*D : (j+1)*D]
+				for d, v := range x {
+					q[d] += y * v
+				}
+			}
+		}
+		orthonormalizeRows(Q, l, D)
+	}
+	// Rayleigh-Ritz on the subspace: B = Q C Q^T = Y^T Y / (n-1)
+	project()
+	B := make([]float64, l*l)
+	for a := 0; a < l; a++ {
+		for b := a; b < l; b++ {
+			dot := 0.0
+			for i := 0; i < n; i++ {
+				dot += Y[i*l+a] * Y[i*l+b]
+			}
+			B[a*l+b] = dot / float64(n-1)
+			B[b*l+a] = B[a*l+b]
+		}
+	}
+	values, vectors := symmetricEigen(B, l)
+	components := make([]float64, k*D)
+	for c := 0; c < k; c++ {
+		component := components[c*D : (c+1)*D]
+		for j := 0; j < l; j++ {
+			w := vectors[c*l+j]
+			for d, q := range Q[j*D : (j+1)*D] {
+				component[d] += w * q
+			}
+		}
+	}
+	return values[:k], components
+}
+
+// orthonormalizeRows runs modified Gram-Schmidt on the rows of the m x D matrix a,
+// rows falling in the span of the previous ones are set to 0
+func orthonormalizeRows(a []float64, m, D int) {
+	for i := 0; i < m; i++ {
+		row := a[i*D : (i+1)*D]
+		original := 0.0
+		for _, v := range row {
+			original += v * v
+		}
+		for j := 0; j < i; j++ {
+			previous := a[j*D : (j+1)*D]
+			dot := 0.0
+			for d, v := range row {
+				dot += v * previous[d]
+			}
+			for d := range row {
+				row[d] -= dot * previous[d]
+			}
+		}
+		norm := 0.0
+		for _, v := range row {
+			norm += v * v
+		}
+		// the span test is relative to the row, whatever the scale of the data
+		norm = math.Sqrt(norm)
+		for d := range row {
+			if norm > 1e-10*math.Sqrt(original) {
+				row[d] /= norm
+			} else {
+				row[d] = 0
+			}
+		}
+	}
+}
+
+// FitPCA fits the principal components of N data of the given dimension, stored row by
+// row. When NumComponents is much smaller than N and dimension, or when both exceed
+// 512, as for the PCA of VladEncode or FisherEncode encodings, the leading components
+// are computed by subspace iteration without forming the covariance. Otherwise the
+// covariance is diagonalized, or the N x N Gram matrix when N is smaller than
+// dimension, which costs O(min(N, dimension)^3) per Jacobi sweep: fitting all the
+// components of large data is slow. Components with a null eigenvalue, such as the
+// direction removed by centering, are dropped.
+func FitPCA(data interface{}, dimension, N uint, options PCAOptions) (PCA, error) {
+	values, err := toFloat64Slice(data)
+	if err != nil {
+		return PCA{}, err
+	}
+	if dimension == 0 || N < 2 {
+		return PCA{}, errors.New("PCA needs a positive dimension and at least two data")
+	}
+	if len(values) < int(N*dimension) {
+		return PCA{}, errors.New("data must hold N x dimension values")
+	}
+	D, n := int(dimension), int(N)
+	mean := make([]float64, D)
+	for i := 0; i < n; i++ {
+		for d := 0; d < D; d++ {
+			mean[d] += values[i*D+d]
+		}
+	}
+	for d := range mean {
+		mean[d] /= float64(n)
+	}
+	centered := make([]float64, n*D)
+	for i := 0; i < n; i++ {
+		for d := 0; d < D; d++ {
+			centered[i*D+d] = values[i*D+d] - mean[d]
+		}
+	}
+
+	var eigenvalues, components []float64
+	size := D
+	if n < D {
+		size = n
+	}
+	k, l := int(options.NumComponents), int(options.NumComponents)+pcaOversampling
+	if k > 0 && l < size && (2*l < size || size > pcaMaxJacobiSize) {
+		eigenvalues, components = truncatedEigen(centered, n, D, k)
+	} else if n >= D {
+		covariance := make([]float64, D*D)
+		for i := 0; i < n; i++ {
+			x := centered[i*D : (i+1)*D]
+			for p := 0; p < D; p++ {
+				for q := p; q < D; q++ {
+					covariance[p*D+q] += x[p] * x[q]
+				}
+			}
+		}
+		for p := 0; p < D; p++ {
+			for q := p; q < D; q++ {
+				covariance[p*D+q] /= float64(n - 1)
+				covariance[q*D+p] = covariance[p*D+q]
+			}
+		}
+		eigenvalues, components = symmetricEigen(covariance, D)
+	} else {
+		// the eigenvectors of X X^T / (n-1) map to the components X^T u / |X^T u|
+		gram := make([]float64, n*n)
+		for i := 0; i < n; i++ {
+			for j := i; j < n; j++ {
+				dot := 0.0
+				for d := 0; d < D; d++ {
+					dot += centered[i*D+d] * centered[j*D+d]
+				}
+				gram[i*n+j] = dot / float64(n-1)
+				gram[j*n+i] = gram[i*n+j]
+			}
+		}
+		var u []float64
+		eigenvalues, u = symmetricEigen(gram, n)
+		components = make([]float64, n*D)
+		for k := 0; k < n; k++ {
+			component := components[k*D : (k+1)*D]
+			for i := 0; i < n; i++ {
+				for d := 0; d < D; d++ {
+					component[d] += u[k*n+i] * centered[i*D+d]
+				}
+			}
+			copy(component, normalizeVector(component))
+		}
+	}
+
+	numComponents := int(options.NumComponents)
+	if numComponents == 0 || numComponents > len(eigenvalues) {
+		numComponents = len(eigenvalues)
+	}
+	for numComponents > 0 && eigenvalues[numComponents-1] <= pcaEpsilon*eigenvalues[0] {
+		numComponents--
+	}
+	if numComponents == 0 {
+		return PCA{}, errors.New("data have no variance")
+	}
+	if options.Power == 0 {
+		options.Power = 0.5
+	}
+	return NewPCAFromModel(PCAModel{
+		Version:        ModelVersion,
+		Dimension:      dimension,
+		NumComponents:  uint(numComponents),
+		Whiten:         options.Whiten,
+		Power:          options.Power,
+		Regularization: options.Regularization,
+		Mean:           mean,
+		Components:     components[:numComponents*D],
+		Eigenvalues:    eigenvalues[:numComponents],
+	})
+}
+
+/* Model */
+
+// NewPCAFromModel returns a PCA with the parameters of model.
+func NewPCAFromModel(model PCAModel) (PCA, error) {
+	if model.Version != ModelVersion {
+		return PCA{}, errors.New("unsupported PCA model version")
+	}
+	if len(model.Mean) != int(model.Dimension) ||
+		len(model.Components) != int(model.Dimension*model.NumComponents) ||
+		len(model.Eigenvalues) != int(model.NumComponents) {
+		return PCA{}, errors.New("PCA model parameters have the wrong length")
+	}
+	scales := make([]float64, model.NumComponents)
+	largest := 0.0
+	for _, eigenvalue := range model.Eigenvalues {
+		largest = math.Max(largest, eigenvalue)
+	}
+	for k, eigenvalue := range model.Eigenvalues {
+		scales[k] = 1
+		if model.Whiten {
+			eigenvalue = math.Max(eigenvalue, pcaEpsilon*largest)
+			denominator := math.Pow(eigenvalue+model.Regularization, model.Power)
+			if denominator > 0 {
+				scales[k] = 1 / denominator
+			}
+		}
+	}
+	return PCA{model: model, scales: scales}, nil
+}
+
+func (pca *PCA) GetModel() PCAModel {
+	return pca.model
+}
+
+func (pca *PCA) GetDimension() uint {
+	return pca.model.Dimension
+}
+
+func (pca *PCA) GetNumComponents() uint {
+	return pca.model.NumComponents
+}
+
+func (pca *PCA) GetMean() []float64 {
+	return append([]float64{}, pca.model.Mean...)
+}
+
+// GetComponents returns the NumComponents x Dimension components
+func (pca *PCA) GetComponents() [][]float64 {
+	return reshapeFloat64(append([]float64{}, pca.model.Components...), int(pca.model.NumComponents), int(pca.model.Dimension))
+}
+
+func (pca *PCA) GetEigenvalues() []float64 {
+	return append([]float64{}, pca.model.Eigenvalues...)
+}
+
+// GetExplainedVariance returns the fraction of the variance kept by the components
+func (pca *PCA) GetExplainedVariance() []float64 {
+	total := 0.0
+	for _, eigenvalue := range pca.model.Eigenvalues {
+		total += eigenvalue
+	}
+	explained := make([]float64, len(pca.model.Eigenvalues))
+	if total == 0 {
+		return explained
+	}
+	for k, eigenvalue := range pca.model.Eigenvalues {
+		explained[k] = eigenvalue / total
+	}
+	return explained
+}
+
+/* Project */
+
+// Project returns the N x NumComponents projections of N data of dimension Dimension,
+// whitened when the PCA whitens.
+func (pca *PCA) Project(data interface{}, N uint) ([]float64, error) {
+	values, err := toFloat64Slice(data)
+	if err != nil {
+		return nil, err
+	}
+	D, K := int(pca.model.Dimension), int(pca.model.NumComponents)
+	if len(values) < int(N)*D {
+		return nil, errors.New("data must hold N x dimension values")
+	}
+	projected := make([]float64, int(N)*K)
+	x := make([]float64, D)
+	for i := 0; i < int(N); i++ {
+		for d := range x {
+			x[d] = values[i*D+d] - pca.model.Mean[d]
+		}
+		for k := 0; k < K; k++ {
+			component := pca.model.Components[k*D : (k+1)*D]
+			dot := 0.0
+			for d, c := range component {
+				dot += c * x[d]
+			}
+			projected[i*K+k] = dot * pca.scales[k]
+		}
+	}
+	return projected, nil
+}
+
+// ProjectFloat32 is Project for float32 data, as returned by Sift and Dsift.
+func (pca *PCA) ProjectFloat32(data []float32, N uint) ([]float32, error) {
+	projected, err := pca.Project(data, N)
+	if err != nil {
+		return nil, err
+	}
+	return toFloat32Slice(projected), nil
+}
+
+// Reconstruct maps N projections back to the input space, undoing the whitening.
+func (pca *PCA) Reconstruct(projected []float64, N uint) ([]float64, error) {
+	D, K := int(pca.model.Dimension), int(pca.model.NumComponents)
+	if len(projected) < int(N)*K {
+		return nil, errors.New("projected must hold N x NumComponents values")
+	}
+	data := make([]float64, int(N)*D)
+	for i := 0; i < int(N); i++ {
+		x := data[i*D : (i+1)*D]
+		copy(x, pca.model.Mean)
+		for k := 0; k < K; k++ {
+			if pca.scales[k] == 0 {
+				continue
+			}
+			y := projected[i*K+k] / pca.scales[k]
+			for d, c := range pca.model.Components[k*D : (k+1)*D] {
+				x[d] += y * c
+			}
+		}
+	}
+	return data, nil
+}
+
+/* Save and load */
+
+// Save writes the PCA in the binary model format.
+func (pca *PCA) Save(w io.Writer) error {
+	model := pca.model
+	whiten := uint32(0)
+	if model.Whiten {
+		whiten = 1
+	}
+	header := []uint32{
+		uint32(model.Version),
+		uint32(model.Dimension),
+		uint32(model.NumComponents),
+		whiten,
+	}
+	if err := binary.Write(w, binary.LittleEndian, pcaMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	parameters := []float64{model.Power, model.Regularization}
+	for _, values := range [][]float64{parameters, model.Mean, model.Components, model.Eigenvalues} {
+		if err := writeModelValues(w, VlTypeDouble, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadPCA reads a PCA written by Save.
+func LoadPCA(r io.Reader) (PCA, error) {
+	header := make([]uint32, 4)
+	if err := readModelHeader(r, pcaMagic, header); err != nil {
+		return PCA{}, err
+	}
+	model := PCAModel{
+		Version:       int(header[0]),
+		Dimension:     uint(header[1]),
+		NumComponents: uint(header[2]),
+		Whiten:        header[3] != 0,
+	}
+	if model.Version != ModelVersion {
+		return PCA{}, errors.New("unsupported PCA model version")
+	}
+	if model.NumComponents > model.Dimension {
+		return PCA{}, errors.New("PCA model has more components than dimensions")
+	}
+	parameters, err := readModelValues(r, VlTypeDouble, 2)
+	if err != nil {
+		return PCA{}, err
+	}
+	model.Power, model.Regularization = parameters[0], parameters[1]
+	if model.Mean, err = readModelValues(r, VlTypeDouble, int(model.Dimension)); err != nil {
+		return PCA{}, err
+	}
+	if model.Components, err = readModelValues(r, VlTypeDouble, int(model.Dimension*model.NumComponents)); err != nil {
+		return PCA{}, err
+	}
+	if model.Eigenvalues, err = readModelValues(r, VlTypeDouble, int(model.NumComponents)); err != nil {
+		return PCA{}, err
+	}
+	return NewPCAFromModel(model)
+}
+
+// SaveJSON writes the PCA as JSON.
+func (pca *PCA) SaveJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(pca.model)
+}
+
+// LoadPCAJSON reads a PCA written by SaveJSON.
+func LoadPCAJSON(r io.Reader) (PCA, error) {
+	var model PCAModel
+	if err := json.NewDecoder(r).Decode(&model); err != nil {
+		return PCA{}, err
+	}
+	return NewPCAFromModel(model)
+}
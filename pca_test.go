@@ -0,0 +1,169 @@
+package vlfeat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSymmetricEigenScaleInvariant(t *testing.T) {
+	for _, s := range []float64{1e-12, 1, 1e12} {
+		values, vectors := symmetricEigen([]float64{2 * s, s, s, 2 * s}, 2)
+		if math.Abs(values[0]-3*s) > 1e-9*s || math.Abs(values[1]-s) > 1e-9*s {
+			t.Errorf("scale %g: eigenvalues %v, want [%g %g]", s, values, 3*s, s)
+		}
+		if math.Abs(math.Abs(vectors[0]*vectors[1]+vectors[2]*vectors[3])) > 1e-9 ||
+			math.Abs(math.Abs(vectors[0])-math.Sqrt(0.5)) > 1e-9 ||
+			math.Abs(math.Abs(vectors[1])-math.Sqrt(0.5)) > 1e-9 {
+			t.Errorf("scale %g: eigenvectors %v, want the diagonals", s, vectors)
+		}
+	}
+}
+
+// lowRankData draws n samples of dimension D with variances 100, 25 and 4 along three
+// random orthonormal directions, returned as basis, plus isotropic noise of the given
+// variance, all multiplied by scale
+func lowRankData(n, D int, noise, scale float64) ([]float64, []float64) {
+	random := rand.New(rand.NewSource(1))
+	basis := make([]float64, 3*D)
+	for i := range basis {
+		basis[i] = random.NormFloat64()
+	}
+	orthonormalizeRows(basis, 3, D)
+	data := make([]float64, n*D)
+	for i := 0; i < n; i++ {
+		x := data[i*D : (i+1)*D]
+		for c, sigma := range []float64{10, 5, 2} {
+			y := sigma * random.NormFloat64()
+			for d := range x {
+				x[d] += y * basis[c*D+d]
+			}
+		}
+		for d := range x {
+			x[d] = scale * (x[d] + math.Sqrt(noise)*random.NormFloat64())
+		}
+	}
+	return data, basis
+}
+
+func TestFitPCASmallScale(t *testing.T) {
+	for _, scale := range []float64{1e-8, 1, 1e6} {
+		data, basis := lowRankData(500, 6, 0.01, scale)
+		pca, err := FitPCA(data, 6, 500, PCAOptions{NumComponents: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		components := pca.GetComponents()
+		for c := range components {
+			dot := 0.0
+			for d, v := range components[c] {
+				dot += v * basis[c*6+d]
+			}
+			if math.Abs(math.Abs(dot)-1) > 1e-2 {
+				t.Errorf("scale %g: component %d is %v off the generating axis", scale, c, math.Abs(dot))
+			}
+		}
+	}
+}
+
+func TestFitPCATruncatedMatchesDense(t *testing.T) {
+	for _, scale := range []float64{1e-8, 1} {
+		data, _ := lowRankData(200, 80, 0.1, scale)
+		dense, err := FitPCA(data, 80, 200, PCAOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		truncated, err := FitPCA(data, 80, 200, PCAOptions{NumComponents: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		denseValues, truncatedValues := dense.GetEigenvalues(), truncated.GetEigenvalues()
+		denseComponents, truncatedComponents := dense.GetComponents(), truncated.GetComponents()
+		for c := 0; c < 3; c++ {
+			if math.Abs(truncatedValues[c]-denseValues[c]) > 1e-6*denseValues[c] {
+				t.Errorf("scale %g, eigenvalue %d: truncated %g, dense %g", scale, c, truncatedValues[c], denseValues[c])
+			}
+			dot := 0.0
+			for d, v := range truncatedComponents[c] {
+				dot += v * denseComponents[c][d]
+			}
+			if math.Abs(math.Abs(dot)-1) > 1e-6 {
+				t.Errorf("scale %g, component %d: |dot| with the dense one is %g", scale, c, math.Abs(dot))
+			}
+		}
+	}
+}
+
+func TestFitPCADropsNullDirections(t *testing.T) {
+	// 5 centered samples span at most 4 directions
+	data, _ := lowRankData(5, 20, 1, 1)
+	pca, err := FitPCA(data, 20, 5, PCAOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pca.GetNumComponents() != 4 {
+		t.Errorf("got %d components, want 4", pca.GetNumComponents())
+	}
+	if _, err := FitPCA(make([]float64, 20), 2, 10, PCAOptions{}); err == nil {
+		t.Error("FitPCA accepted data without variance")
+	}
+}
+
+func TestPCAWhitenReconstructAndSave(t *testing.T) {
+	data, _ := lowRankData(1000, 4, 1, 1)
+	pca, err := FitPCA(data, 4, 1000, PCAOptions{Whiten: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	projected, err := pca.Project(data, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := 0; k < 4; k++ {
+		variance := 0.0
+		for i := 0; i < 1000; i++ {
+			variance += projected[i*4+k] * projected[i*4+k] / 999
+		}
+		if math.Abs(variance-1) > 1e-6 {
+			t.Errorf("whitened component %d has variance %g, want 1", k, variance)
+		}
+	}
+	reconstructed, err := pca.Reconstruct(projected, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range reconstructed {
+		if math.Abs(v-data[i]) > 1e-9 {
+			t.Fatalf("reconstructed[%d] = %g, want %g", i, v, data[i])
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := pca.Save(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadPCA(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := loaded.Project(data, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range again {
+		if v != projected[i] {
+			t.Fatalf("loaded PCA projects %g at %d, want %g", v, i, projected[i])
+		}
+	}
+}
+
+func TestLoadPCARejectsBadHeader(t *testing.T) {
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, pcaMagic)
+	binary.Write(&buffer, binary.LittleEndian, []uint32{ModelVersion, 4, 5, 0})
+	if _, err := LoadPCA(&buffer); err == nil {
+		t.Error("LoadPCA accepted more components than dimensions")
+	}
+}
@@ -0,0 +1,433 @@
+package vlfeat
+
+import (
+	"errors"
+	"sort"
+)
+
+// PQMatch is a database vector found by an ADC search. ID is the position of the code
+// for ProductQuantizer.SearchADC and the id given to IVFPQIndex.Add for IVFPQIndex.
+// Distance is the approximate squared L2 distance to the query.
+type PQMatch struct {
+	ID       uint    `json:"id"`
+	Distance float64 `json:"distance"`
+}
+
+// ProductQuantizer splits vectors into numSubspaces contiguous subvectors and quantizes
+// every subvector with its own Kmeans codebook of at most 256 centers, so that a
+// vector is stored as numSubspaces bytes (Jegou et al. 2011).
+type ProductQuantizer struct {
+	dimension    uint
+	numSubspaces uint
+	numCentroids uint
+	codebooks    []Kmeans
+	// subspace -> numCentroids x subDimension centers
+	centers [][]float32
+}
+
+// NewProductQuantizer returns an untrained quantizer. dimension must be a multiple of
+// numSubspaces and numCentroids at most 256.
+func NewProductQuantizer(dimension, numSubspaces, numCentroids uint) (ProductQuantizer, error) {
+	if numSubspaces == 0 || dimension == 0 || dimension%numSubspaces != 0 {
+		return ProductQuantizer{}, errors.New("dimension must be a positive multiple of numSubspaces")
+	}
+	if numCentroids == 0 || numCentroids > 256 {
+		return ProductQuantizer{}, errors.New("numCentroids must be between 1 and 256")
+	}
+	return ProductQuantizer{
+		dimension:    dimension,
+		numSubspaces: numSubspaces,
+		numCentroids: numCentroids,
+	}, nil
+}
+
+// Delete frees the Kmeans of every subspace
+func (pq *ProductQuantizer) Delete() {
+	for _, codebook := range pq.codebooks {
+		codebook.Delete()
+	}
+	pq.codebooks = nil
+	pq.centers = nil
+}
+
+func (pq *ProductQuantizer) GetDimension() uint {
+	return pq.dimension
+}
+
+func (pq *ProductQuantizer) GetNumSubspaces() uint {
+	return pq.numSubspaces
+}
+
+func (pq *ProductQuantizer) GetNumCentroids() uint {
+	return pq.numCentroids
+}
+
+// GetCodebook returns the numCentroids x dimension/numSubspaces centers of a subspace
+func (pq *ProductQuantizer) GetCodebook(subspace uint) []float32 {
+	if subspace >= uint(len(pq.centers)) {
+		return nil
+	}
+	return append([]float32{}, pq.centers[subspace]...)
+}
+
+// subvectors copies subspace s of the N vectors
+func (pq *ProductQuantizer) subvectors(data []float32, N, s uint) []float32 {
+	d := pq.dimension / pq.numSubspaces
+	sub := make([]float32, 0, N*d)
+	for i := uint(0); i < N; i++ {
+		start := i*pq.dimension + s*d
+		sub = append(sub, data[start:start+d]...)
+	}
+	return sub
+}
+
+// Train clusters every subspace of the N training vectors, stored row by row.
+func (pq *ProductQuantizer) Train(data []float32, N uint) error {
+	if N < pq.numCentroids {
+		return errors.New("Train needs at least numCentroids vectors")
+	}
+	if len(data) < int(N*pq.dimension) {
+		return errors.New("data must hold N x dimension values")
+	}
+	pq.Delete()
+	d := pq.dimension / pq.numSubspaces
+	for s := uint(0); s < pq.numSubspaces; s++ {
+		kmeans, err := NewKeans(VlTypeFloat, VlDistanceL2)
+		if err != nil {
+			pq.Delete()
+			return err
+		}
+		if _, err := kmeans.Cluster(pq.subvectors(data, N, s), d, N, pq.numCentroids); err != nil {
+			kmeans.Delete()
+			pq.Delete()
+			return err
+		}
+		pq.codebooks = append(pq.codebooks, kmeans)
+		centers := make([]float32, pq.numCentroids*d)
+		for i, c := range kmeans.GetCenters() {
+			centers[i] = float32(c)
+		}
+		pq.centers = append(pq.centers, centers)
+	}
+	return nil
+}
+
+// Encode returns the codes of the N vectors, numSubspaces bytes per vector.
+func (pq *ProductQuantizer) Encode(data []float32, N uint) ([]uint8, error) {
+	if pq.codebooks == nil {
+		return nil, errors.New("ProductQuantizer is not trained")
+	}
+	if len(data) < int(N*pq.dimension) {
+		return nil, errors.New("data must hold N x dimension values")
+	}
+	m := pq.numSubspaces
+	codes := make([]uint8, N*m)
+	if N == 0 {
+		return codes, nil
+	}
+	for s, codebook := range pq.codebooks {
+		assignments, _, err := codebook.Quantize(pq.subvectors(data, N, uint(s)), N)
+		if err != nil {
+			return nil, err
+		}
+		for i, k := range assignments {
+			codes[uint(i)*m+uint(s)] = uint8(k)
+		}
+	}
+	return codes, nil
+}
+
+// Decode returns the N vectors approximated by their codes.
+func (pq *ProductQuantizer) Decode(codes []uint8, N uint) ([]float32, error) {
+	if pq.codebooks == nil {
+		return nil, errors.New("ProductQuantizer is not trained")
+	}
+	m := pq.numSubspaces
+	if len(codes) < int(N*m) {
+		return nil, errors.New("codes must hold N x numSubspaces values")
+	}
+	d := pq.dimension / m
+	data := make([]float32, 0, N*pq.dimension)
+	for i := uint(0); i < N; i++ {
+		for s := uint(0); s < m; s++ {
+			k := uint(codes[i*m+s])
+			if k >= pq.numCentroids {
+				return nil, errors.New("code out of range")
+			}
+			data = append(data, pq.centers[s][k*d:(k+1)*d]...)
+		}
+	}
+	return data, nil
+}
+
+// DistanceTable returns the squared L2 distances between the subvectors of query and
+// the centers of their subspace, numSubspaces x numCentroids values.
+func (pq *ProductQuantizer) DistanceTable(query []float32) ([]float32, error) {
+	if pq.codebooks == nil {
+		return nil, errors.New("ProductQuantizer is not trained")
+	}
+	if len(query) != int(pq.dimension) {
+		return nil, errors.New("query must have the dimension of the quantizer")
+	}
+	m, K := pq.numSubspaces, pq.numCentroids
+	d := pq.dimension / m
+	table := make([]float32, m*K)
+	for s := uint(0); s < m; s++ {
+		sub := query[s*d : (s+1)*d]
+		for k := uint(0); k < K; k++ {
+			center := pq.centers[s][k*d : (k+1)*d]
+			sum := float32(0)
+			for j, c := range center {
+				diff := sub[j] - c
+				sum += diff * diff
+			}
+			table[s*K+k] = sum
+		}
+	}
+	return table, nil
+}
+
+// adcDistance sums the table entries of a code
+func adcDistance(table []float32, code []uint8, K uint) float32 {
+	sum := float32(0)
+	for s, k := range code {
+		sum += table[uint(s)*K+uint(k)]
+	}
+	return sum
+}
+
+// SearchADC returns the topK codes closest to query by asymmetric distance computation,
+// the query is not quantized. All codes are returned when topK is 0.
+func (pq *ProductQuantizer) SearchADC(query []float32, codes []uint8, N uint, topK int) ([]PQMatch, error) {
+	m := pq.numSubspaces
+	if len(codes) < int(N*m) {
+		return nil, errors.New("codes must hold N x numSubspaces values")
+	}
+	table, err := pq.DistanceTable(query)
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]PQMatch, N)
+	for i := uint(0); i < N; i++ {
+		matches[i] = PQMatch{ID: i, Distance: float64(adcDistance(table, codes[i*m:(i+1)*m], pq.numCentroids))}
+	}
+	return sortPQMatches(matches, topK), nil
+}
+
+func sortPQMatches(matches []PQMatch, topK int) []PQMatch {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	if topK > 0 && len(matches) > topK {
+		matches = matches[:topK]
+	}
+	return matches
+}
+
+/* IVF-PQ */
+
+// IVFPQIndex is an inverted file over a coarse Kmeans quantizer whose lists store the
+// product quantization codes of the residuals to the coarse centers (IVFADC).
+type IVFPQIndex struct {
+	dimension uint
+	numLists  uint
+	coarse    Kmeans
+	centers   []float32
+	pq        ProductQuantizer
+
+	// list -> ids and codes of the vectors, numSubspaces bytes per vector
+	ids   [][]uint
+	codes [][]uint8
+}
+
+// NewIVFPQIndex returns an untrained index with numLists coarse centers and residuals
+// coded with numSubspaces codebooks of numCentroids centers.
+func NewIVFPQIndex(dimension, numLists, numSubspaces, numCentroids uint) (IVFPQIndex, error) {
+	if numLists == 0 {
+		return IVFPQIndex{}, errors.New("numLists must be positive")
+	}
+	pq, err := NewProductQuantizer(dimension, numSubspaces, numCentroids)
+	if err != nil {
+		return IVFPQIndex{}, err
+	}
+	coarse, err := NewKeans(VlTypeFloat, VlDistanceL2)
+	if err != nil {
+		return IVFPQIndex{}, err
+	}
+	return IVFPQIndex{
+		dimension: dimension,
+		numLists:  numLists,
+		coarse:    coarse,
+		pq:        pq,
+		ids:       make([][]uint, numLists),
+		codes:     make([][]uint8, numLists),
+	}, nil
+}
+
+// Delete frees the coarse quantizer and the product quantizer
+func (index *IVFPQIndex) Delete() {
+	index.coarse.Delete()
+	index.pq.Delete()
+}
+
+func (index *IVFPQIndex) GetDimension() uint {
+	return index.dimension
+}
+
+func (index *IVFPQIndex) GetNumLists() uint {
+	return index.numLists
+}
+
+// GetNumVectors returns the number of indexed vectors
+func (index *IVFPQIndex) GetNumVectors() uint {
+	n := 0
+	for _, ids := range index.ids {
+		n += len(ids)
+	}
+	return uint(n)
+}
+
+// residuals quantizes the N vectors with the coarse quantizer and returns their lists
+// and their residuals
+func (index *IVFPQIndex) residuals(data []float32, N uint) ([]uint, []float32, error) {
+	lists, _, err := index.coarse.Quantize(data[:N*index.dimension], N)
+	if err != nil {
+		return nil, nil, err
+	}
+	D := index.dimension
+	residuals := make([]float32, N*D)
+	for i, list := range lists {
+		for j := uint(0); j < D; j++ {
+			residuals[uint(i)*D+j] = data[uint(i)*D+j] - index.centers[list*D+j]
+		}
+	}
+	return lists, residuals, nil
+}
+
+// Train learns the coarse quantizer and the product quantizer of the residuals from N
+// training vectors, stored row by row. Train empties the index.
+func (index *IVFPQIndex) Train(data []float32, N uint) error {
+	if N < index.numLists || N < index.pq.numCentroids {
+		return errors.New("Train needs at least numLists and numCentroids vectors")
+	}
+	if len(data) < int(N*index.dimension) {
+		return errors.New("data must hold N x dimension values")
+	}
+	if _, err := index.coarse.Cluster(data[:N*index.dimension], index.dimension, N, index.numLists); err != nil {
+		return err
+	}
+	index.centers = make([]float32, index.numLists*index.dimension)
+	for i, c := range index.coarse.GetCenters() {
+		index.centers[i] = float32(c)
+	}
+	_, residuals, err := index.residuals(data, N)
+	if err != nil {
+		return err
+	}
+	index.ids = make([][]uint, index.numLists)
+	index.codes = make([][]uint8, index.numLists)
+	return index.pq.Train(residuals, N)
+}
+
+// Add indexes the N vectors with the given ids.
+func (index *IVFPQIndex) Add(ids []uint, data []float32, N uint) error {
+	if index.centers == nil {
+		return errors.New("IVFPQIndex is not trained")
+	}
+	if len(ids) < int(N) || len(data) < int(N*index.dimension) {
+		return errors.New("ids must hold N values and data N x dimension values")
+	}
+	if N == 0 {
+		return nil
+	}
+	lists, residuals, err := index.residuals(data, N)
+	if err != nil {
+		return err
+	}
+	codes, err := index.pq.Encode(residuals, N)
+	if err != nil {
+		return err
+	}
+	m := index.pq.numSubspaces
+	for i, list := range lists {
+		index.ids[list] = append(index.ids[list], ids[i])
+		index.codes[list] = append(index.codes[list], codes[uint(i)*m:uint(i+1)*m]...)
+	}
+	return nil
+}
+
+// Remove removes the vectors with the given id and returns their number.
+func (index *IVFPQIndex) Remove(id uint) int {
+	m := index.pq.numSubspaces
+	removed := 0
+	for list, ids := range index.ids {
+		keptIDs := ids[:0]
+		keptCodes := index.codes[list][:0]
+		for i, other := range ids {
+			if other == id {
+				removed++
+				continue
+			}
+			keptIDs = append(keptIDs, other)
+			keptCodes = append(keptCodes, index.codes[list][uint(i)*m:uint(i+1)*m]...)
+		}
+		index.ids[list] = keptIDs
+		index.codes[list] = keptCodes
+	}
+	return removed
+}
+
+// Search visits the numProbes lists whose coarse centers are closest to query and
+// returns the topK closest vectors by asymmetric distance, all the visited vectors
+// when topK is 0.
+func (index *IVFPQIndex) Search(query []float32, topK int, numProbes uint) ([]PQMatch, error) {
+	if index.centers == nil {
+		return nil, errors.New("IVFPQIndex is not trained")
+	}
+	if len(query) != int(index.dimension) {
+		return nil, errors.New("query must have the dimension of the index")
+	}
+	if numProbes == 0 {
+		numProbes = 1
+	}
+	if numProbes > index.numLists {
+		numProbes = index.numLists
+	}
+	D := index.dimension
+	lists := make([]PQMatch, index.numLists)
+	for list := uint(0); list < index.numLists; list++ {
+		sum := 0.0
+		for j := uint(0); j < D; j++ {
+			diff := float64(query[j] - index.centers[list*D+j])
+			sum += diff * diff
+		}
+		lists[list] = PQMatch{ID: list, Distance: sum}
+	}
+	lists = sortPQMatches(lists, int(numProbes))
+
+	m, K := index.pq.numSubspaces, index.pq.numCentroids
+	residual := make([]float32, D)
+	matches := []PQMatch{}
+	for _, probe := range lists {
+		list := probe.ID
+		if len(index.ids[list]) == 0 {
+			continue
+		}
+		for j := uint(0); j < D; j++ {
+			residual[j] = query[j] - index.centers[list*D+j]
+		}
+		table, err := index.pq.DistanceTable(residual)
+		if err != nil {
+			return nil, err
+		}
+		codes := index.codes[list]
+		for i, id := range index.ids[list] {
+			distance := adcDistance(table, codes[uint(i)*m:uint(i+1)*m], K)
+			matches = append(matches, PQMatch{ID: id, Distance: float64(distance)})
+		}
+	}
+	return sortPQMatches(matches, topK), nil
+}
@@ -0,0 +1,126 @@
+package vlfeat
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// newTestProductQuantizer returns a quantizer of 4 dimensions with 2 subspaces of 3
+// random centers, trained without Kmeans
+func newTestProductQuantizer(random *rand.Rand) ProductQuantizer {
+	pq, _ := NewProductQuantizer(4, 2, 3)
+	for s := 0; s < 2; s++ {
+		centers := make([]float32, 3*2)
+		for i := range centers {
+			centers[i] = float32(random.NormFloat64())
+		}
+		pq.centers = append(pq.centers, centers)
+		// only marks the quantizer as trained
+		pq.codebooks = append(pq.codebooks, Kmeans{})
+	}
+	return pq
+}
+
+func TestNewProductQuantizerValidation(t *testing.T) {
+	for _, args := range [][3]uint{{0, 1, 4}, {6, 4, 16}, {8, 0, 16}, {8, 2, 0}, {8, 2, 257}} {
+		if _, err := NewProductQuantizer(args[0], args[1], args[2]); err == nil {
+			t.Errorf("NewProductQuantizer%v succeeded", args)
+		}
+	}
+	pq, _ := NewProductQuantizer(8, 2, 16)
+	if _, err := pq.Encode(make([]float32, 8), 1); err == nil {
+		t.Error("an untrained quantizer encoded vectors")
+	}
+}
+
+func TestProductQuantizerADC(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	pq := newTestProductQuantizer(random)
+	codes := []uint8{0, 2, 1, 1, 2, 0, 1, 0}
+	decoded, err := pq.Decode(codes, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded[:4], append(pq.GetCodebook(0)[0:2], pq.GetCodebook(1)[4:6]...)) {
+		t.Errorf("first vector decoded to %v", decoded[:4])
+	}
+
+	// the asymmetric distance is the squared distance to the decoded vector
+	query := []float32{0.3, -0.2, 1, 0.5}
+	matches, err := pq.SearchADC(query, codes, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 4 {
+		t.Fatalf("%d matches, want 4", len(matches))
+	}
+	for i, match := range matches {
+		want := 0.0
+		for j, q := range query {
+			diff := float64(q - decoded[match.ID*4+uint(j)])
+			want += diff * diff
+		}
+		if math.Abs(match.Distance-want) > 1e-5 {
+			t.Errorf("code %d: distance %g, want %g", match.ID, match.Distance, want)
+		}
+		if i > 0 && match.Distance < matches[i-1].Distance {
+			t.Errorf("matches are not sorted: %v", matches)
+		}
+	}
+	if top, _ := pq.SearchADC(query, codes, 4, 2); !reflect.DeepEqual(top, matches[:2]) {
+		t.Errorf("top 2 = %v, want %v", top, matches[:2])
+	}
+
+	if _, err := pq.Decode([]uint8{3, 0}, 1); err == nil {
+		t.Error("Decode accepted a code out of range")
+	}
+	if _, err := pq.DistanceTable(query[:3]); err == nil {
+		t.Error("DistanceTable accepted a query of the wrong dimension")
+	}
+}
+
+func TestSortPQMatchesBreaksTiesByID(t *testing.T) {
+	matches := sortPQMatches([]PQMatch{{3, 1}, {1, 2}, {0, 1}, {2, 0}}, 3)
+	if !reflect.DeepEqual(matches, []PQMatch{{2, 0}, {0, 1}, {3, 1}}) {
+		t.Errorf("matches = %v", matches)
+	}
+}
+
+func TestIVFPQIndexSearch(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	// two coarse centers far apart, vectors are stored as residuals
+	index := IVFPQIndex{
+		dimension: 4,
+		numLists:  2,
+		centers:   []float32{0, 0, 0, 0, 100, 100, 100, 100},
+		pq:        newTestProductQuantizer(random),
+		ids:       [][]uint{{10, 11}, {20, 21, 20}},
+		codes:     [][]uint8{{0, 0, 1, 1}, {2, 2, 0, 1, 1, 0}},
+	}
+	query := []float32{100, 100, 100, 100}
+	matches, err := index.Search(query, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one probe visits the list of the closest center only
+	if len(matches) != 3 {
+		t.Fatalf("matches = %v, want the 3 vectors of list 1", matches)
+	}
+	for _, match := range matches {
+		if match.ID < 20 {
+			t.Errorf("match %v is in an unvisited list", match)
+		}
+	}
+	if matches, _ := index.Search(query, 0, 5); len(matches) != 5 {
+		t.Errorf("%d matches with every list probed, want 5", len(matches))
+	}
+
+	if removed := index.Remove(20); removed != 2 {
+		t.Errorf("removed %d vectors, want 2", removed)
+	}
+	if index.GetNumVectors() != 3 || !reflect.DeepEqual(index.codes[1], []uint8{0, 1}) {
+		t.Errorf("%d vectors with codes %v left, want 3 and list 1 holding [0 1]", index.GetNumVectors(), index.codes[1])
+	}
+}
@@ -0,0 +1,279 @@
+package vlfeat
+
+import (
+	"errors"
+	"sort"
+)
+
+type QueryExpansionMethod int
+
+const (
+	// search with the average of the query and verified vectors
+	AverageQueryExpansion QueryExpansionMethod = 0
+	// search with a linear SVM trained on the query and verified vectors as positives
+	// and the lowest ranked images as negatives
+	DiscriminativeQueryExpansion QueryExpansionMethod = 1
+)
+
+// QueryExpansionOptions control query expansion. The NumExpanded first results with at
+// least MinInliers inliers expand the query. NumNegatives, Lambda and NumIterations
+// configure the SVM of the discriminative variant. Zero values mean 10 expanded
+// results, 6 inliers, 200 negatives, lambda 1e-4 and 10000 iterations.
+type QueryExpansionOptions struct {
+	Method        QueryExpansionMethod
+	NumExpanded   int
+	MinInliers    int
+	NumNegatives  int
+	Lambda        float64
+	NumIterations int
+}
+
+func (options *QueryExpansionOptions) setDefaults() {
+	if options.NumExpanded == 0 {
+		options.NumExpanded = 10
+	}
+	if options.MinInliers == 0 {
+		options.MinInliers = 6
+	}
+	if options.NumNegatives == 0 {
+		options.NumNegatives = 200
+	}
+	if options.Lambda == 0 {
+		options.Lambda = 1e-4
+	}
+	if options.NumIterations == 0 {
+		options.NumIterations = 10000
+	}
+}
+
+// expansionImages returns the verified images used to expand the query
+func expansionImages(verified []SpatialMatch, options QueryExpansionOptions) []uint {
+	ids := []uint{}
+	for _, match := range verified {
+		if len(ids) == options.NumExpanded {
+			break
+		}
+		if match.NumInliers >= options.MinInliers {
+			ids = append(ids, match.ImageID)
+		}
+	}
+	return ids
+}
+
+// negativeImages returns the numNegatives images with the lowest scores, images
+// missing from scores count as 0
+func negativeImages(ids []uint, scores map[uint]float64, exclude map[uint]bool, numNegatives int) []uint {
+	negatives := []uint{}
+	for _, id := range ids {
+		if !exclude[id] {
+			negatives = append(negatives, id)
+		}
+	}
+	sort.SliceStable(negatives, func(i, j int) bool {
+		return scores[negatives[i]] < scores[negatives[j]]
+	})
+	if len(negatives) > numNegatives {
+		negatives = negatives[:numNegatives]
+	}
+	return negatives
+}
+
+// trainLinearSVM trains w and b with the SDCA solver of Svm, weighting the samples so
+// that the few positives weigh as much as the negatives
+func trainLinearSVM(positives, negatives [][]float64, lambda float64, numIterations int) ([]float64, float64, error) {
+	dimension := len(positives[0])
+	numData := len(positives) + len(negatives)
+	data := make([]float64, 0, numData*dimension)
+	labels := make([]float64, 0, numData)
+	weights := make([]float64, 0, numData)
+	for _, x := range positives {
+		data = append(data, x...)
+		labels = append(labels, 1)
+		weights = append(weights, float64(numData)/(2*float64(len(positives))))
+	}
+	for _, x := range negatives {
+		data = append(data, x...)
+		labels = append(labels, -1)
+		weights = append(weights, float64(numData)/(2*float64(len(negatives))))
+	}
+	svm, err := NewSvm(VlSvmSolverSdca, data, uint(dimension), uint(numData), labels, lambda)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer svm.Delete()
+	svm.SetMaxNumIterations(uint(numIterations))
+	if err := svm.SetWeights(weights); err != nil {
+		return nil, 0, err
+	}
+	svm.Train()
+	return svm.GetModel(), svm.GetBias(), nil
+}
+
+/* Inverted index */
+
+// compactVectors turns sparse weights into dense vectors over the words that occur in
+// at least one of them, component i standing for words[i], so that the discriminative
+// expansion does not scale with the vocabulary size
+func compactVectors(sparse []map[uint]float64) ([]uint, [][]float64) {
+	columns := map[uint]int{}
+	words := []uint{}
+	for _, weights := range sparse {
+		for word := range weights {
+			if _, ok := columns[word]; !ok {
+				columns[word] = 0
+				words = append(words, word)
+			}
+		}
+	}
+	sort.Slice(words, func(i, j int) bool { return words[i] < words[j] })
+	for i, word := range words {
+		columns[word] = i
+	}
+	vectors := make([][]float64, len(sparse))
+	for i, weights := range sparse {
+		vectors[i] = make([]float64, len(words))
+		for word, w := range weights {
+			vectors[i][columns[word]] = w
+		}
+	}
+	return words, vectors
+}
+
+// ExpandInvertedIndexQuery searches the index again with the query expanded by the
+// verified results, typically from SpatialReranker.Rerank on the results of
+// index.Search(words, ...). Without verified results it returns index.Search(words, topK).
+func ExpandInvertedIndexQuery(index *InvertedIndex, words []uint, verified []SpatialMatch, topK int, options QueryExpansionOptions) ([]RetrievalMatch, error) {
+	options.setDefaults()
+	ids := expansionImages(verified, options)
+	if len(ids) == 0 {
+		return index.Search(words, topK), nil
+	}
+	counts := map[uint]float64{}
+	for _, word := range words {
+		if word < index.numWords {
+			counts[word]++
+		}
+	}
+	query := make(map[uint]float64, len(counts))
+	for word, count := range counts {
+		query[word] = count * index.idf(word)
+	}
+	normalizeWeights(query)
+	positives := []map[uint]float64{query}
+	for _, id := range ids {
+		if tfidf, ok := index.GetTFIDF(id); ok {
+			positives = append(positives, tfidf)
+		}
+	}
+
+	if options.Method == AverageQueryExpansion {
+		average := map[uint]float64{}
+		for _, positive := range positives {
+			for word, w := range positive {
+				average[word] += w / float64(len(positives))
+			}
+		}
+		return index.SearchWeights(average, topK), nil
+	}
+	if options.Method != DiscriminativeQueryExpansion {
+		return nil, errors.New("unknown query expansion method")
+	}
+
+	exclude := map[uint]bool{}
+	for _, id := range ids {
+		exclude[id] = true
+	}
+	scores := map[uint]float64{}
+	for _, match := range index.SearchWeights(query, 0) {
+		scores[match.ImageID] = match.Score
+	}
+	negativeIDs := negativeImages(index.GetImageIDs(), scores, exclude, options.NumNegatives)
+	if len(negativeIDs) == 0 {
+		return nil, errors.New("no image left for the negatives")
+	}
+	// the words absent from every sample get a null weight, the SVM is trained on
+	// the others only
+	samples := append([]map[uint]float64{}, positives...)
+	for _, id := range negativeIDs {
+		tfidf, _ := index.GetTFIDF(id)
+		samples = append(samples, tfidf)
+	}
+	words, vectors := compactVectors(samples)
+	if len(words) == 0 {
+		return nil, errors.New("query, expansion and negative images hold no words")
+	}
+	w, _, err := trainLinearSVM(vectors[:len(positives)], vectors[len(positives):], options.Lambda, options.NumIterations)
+	if err != nil {
+		return nil, err
+	}
+	weights := map[uint]float64{}
+	for i, v := range w {
+		if v != 0 {
+			weights[words[i]] = v
+		}
+	}
+	return index.SearchWeights(weights, topK), nil
+}
+
+/* Vector index */
+
+// ExpandVectorIndexQuery searches the index again with the query vector, for example a
+// VladEncode encoding, expanded by the verified results. Without verified results it
+// returns index.Search(query, topK).
+func ExpandVectorIndexQuery(index *VectorIndex, query []float64, verified []SpatialMatch, topK int, options QueryExpansionOptions) ([]RetrievalMatch, error) {
+	if len(query) != int(index.dimension) {
+		return nil, errors.New("query must have the dimension of the index")
+	}
+	options.setDefaults()
+	ids := expansionImages(verified, options)
+	if len(ids) == 0 {
+		return index.Search(query, topK)
+	}
+	positives := [][]float64{normalizeVector(query)}
+	for _, id := range ids {
+		if vector, ok := index.GetVector(id); ok {
+			positives = append(positives, vector)
+		}
+	}
+
+	if options.Method == AverageQueryExpansion {
+		average := make([]float64, index.dimension)
+		for _, positive := range positives {
+			for i, v := range positive {
+				average[i] += v / float64(len(positives))
+			}
+		}
+		return index.Search(average, topK)
+	}
+	if options.Method != DiscriminativeQueryExpansion {
+		return nil, errors.New("unknown query expansion method")
+	}
+
+	exclude := map[uint]bool{}
+	for _, id := range ids {
+		exclude[id] = true
+	}
+	matches, err := index.Search(query, 0)
+	if err != nil {
+		return nil, err
+	}
+	allIDs := make([]uint, len(matches))
+	scores := make(map[uint]float64, len(matches))
+	for i, match := range matches {
+		allIDs[i] = match.ImageID
+		scores[match.ImageID] = match.Score
+	}
+	negativeIDs := negativeImages(allIDs, scores, exclude, options.NumNegatives)
+	if len(negativeIDs) == 0 {
+		return nil, errors.New("no image left for the negatives")
+	}
+	negatives := make([][]float64, len(negativeIDs))
+	for i, id := range negativeIDs {
+		negatives[i], _ = index.GetVector(id)
+	}
+	w, _, err := trainLinearSVM(positives, negatives, options.Lambda, options.NumIterations)
+	if err != nil {
+		return nil, err
+	}
+	return index.Search(w, topK)
+}
@@ -0,0 +1,61 @@
+package vlfeat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompactVectors(t *testing.T) {
+	words, vectors := compactVectors([]map[uint]float64{
+		{900000: 1, 7: 2},
+		{},
+		{7: 3, 42: 4},
+	})
+	if !reflect.DeepEqual(words, []uint{7, 42, 900000}) {
+		t.Fatalf("words = %v, want [7 42 900000]", words)
+	}
+	want := [][]float64{{2, 0, 1}, {0, 0, 0}, {3, 4, 0}}
+	if !reflect.DeepEqual(vectors, want) {
+		t.Errorf("vectors = %v, want %v", vectors, want)
+	}
+}
+
+func TestExpandInvertedIndexQueryAverage(t *testing.T) {
+	index := NewInvertedIndex(10)
+	// image 2 shares words with the query, image 3 only with image 2
+	images := map[uint][]uint{
+		1: {0, 1},
+		2: {2, 3, 4},
+		3: {4, 5, 6},
+		4: {7, 8},
+	}
+	for id, words := range images {
+		if err := index.Add(id, words); err != nil {
+			t.Fatal(err)
+		}
+	}
+	query := []uint{2, 3}
+	for _, match := range index.Search(query, 0) {
+		if match.ImageID == 3 {
+			t.Fatal("image 3 should not match the query before expansion")
+		}
+	}
+	verified := []SpatialMatch{{ImageID: 2, NumInliers: 10}}
+	matches, err := ExpandInvertedIndexQuery(&index, query, verified, 0, QueryExpansionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].ImageID != 2 || matches[1].ImageID != 3 {
+		t.Errorf("expanded matches = %v, want images 2 then 3", matches)
+	}
+
+	// results with too few inliers do not expand the query
+	verified[0].NumInliers = 2
+	matches, err = ExpandInvertedIndexQuery(&index, query, verified, 0, QueryExpansionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].ImageID != 2 {
+		t.Errorf("unexpanded matches = %v, want image 2 only", matches)
+	}
+}
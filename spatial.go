@@ -0,0 +1,302 @@
+package vlfeat
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// SpatialMatch is a candidate image after geometric verification. Transform is the
+// affine map [a11 a12 tx; a21 a22 ty] from the query to the image, Inliers holds the
+// (query feature, image feature) pairs consistent with it.
+type SpatialMatch struct {
+	ImageID    uint       `json:"imageId"`
+	Score      float64    `json:"score"`
+	BoWScore   float64    `json:"bowScore"`
+	NumInliers int        `json:"numInliers"`
+	Transform  [6]float64 `json:"transform"`
+	Inliers    [][2]int   `json:"inliers"`
+}
+
+// SpatialVerificationOptions are the inlier tolerances in pixels of the three stages of
+// the verification, as in vl_demo_retrieval: the affine map hypothesized from a single
+// pair of frames, then two least squares refinements. MinInliers is the least number
+// of inliers for an image to be considered verified, MaxMatchesPerWord caps the
+// candidate pairs of a bursty word. Zero values mean 20, 15, 8, 6 and 10.
+type SpatialVerificationOptions struct {
+	Tolerance1        float64
+	Tolerance2        float64
+	Tolerance3        float64
+	MinInliers        int
+	MaxMatchesPerWord int
+}
+
+func (options *SpatialVerificationOptions) setDefaults() {
+	if options.Tolerance1 == 0 {
+		options.Tolerance1 = 20
+	}
+	if options.Tolerance2 == 0 {
+		options.Tolerance2 = 15
+	}
+	if options.Tolerance3 == 0 {
+		options.Tolerance3 = 8
+	}
+	if options.MinInliers == 0 {
+		options.MinInliers = 6
+	}
+	if options.MaxMatchesPerWord == 0 {
+		options.MaxMatchesPerWord = 10
+	}
+}
+
+// SpatialReranker stores the frames and visual words of the database images and
+// re-ranks retrieval results by geometric verification.
+type SpatialReranker struct {
+	frames map[uint][]CovDetFrameOrientedEllipse
+	words  map[uint][]uint
+}
+
+func NewSpatialReranker() SpatialReranker {
+	return SpatialReranker{
+		frames: map[uint][]CovDetFrameOrientedEllipse{},
+		words:  map[uint][]uint{},
+	}
+}
+
+/* Manage the database */
+
+// Add stores the frames of image id and the visual word of each of them, replacing
+// the image if it exists.
+func (sr *SpatialReranker) Add(id uint, frames []CovDetFrameOrientedEllipse, words []uint) error {
+	if len(frames) != len(words) {
+		return errors.New("frames and words must have the same length")
+	}
+	sr.frames[id] = append([]CovDetFrameOrientedEllipse{}, frames...)
+	sr.words[id] = append([]uint{}, words...)
+	return nil
+}
+
+// Remove removes image id, it returns false if it was not stored.
+func (sr *SpatialReranker) Remove(id uint) bool {
+	if _, ok := sr.frames[id]; !ok {
+		return false
+	}
+	delete(sr.frames, id)
+	delete(sr.words, id)
+	return true
+}
+
+func (sr *SpatialReranker) GetNumImages() uint {
+	return uint(len(sr.frames))
+}
+
+// GetImage returns the stored frames and words of image id
+func (sr *SpatialReranker) GetImage(id uint) ([]CovDetFrameOrientedEllipse, []uint, bool) {
+	frames, ok := sr.frames[id]
+	return frames, sr.words[id], ok
+}
+
+/* Verification */
+
+// Verify matches the query features to the features of image id sharing their visual
+// word and returns the affine map with the most inliers.
+func (sr *SpatialReranker) Verify(frames []CovDetFrameOrientedEllipse, words []uint, id uint, options SpatialVerificationOptions) (SpatialMatch, error) {
+	if len(frames) != len(words) {
+		return SpatialMatch{}, errors.New("frames and words must have the same length")
+	}
+	imageFrames, ok := sr.frames[id]
+	if !ok {
+		return SpatialMatch{}, errors.New("image is not stored")
+	}
+	options.setDefaults()
+	matches := matchByWord(words, sr.words[id], options.MaxMatchesPerWord)
+	match := geometricVerification(frames, imageFrames, matches, options)
+	match.ImageID = id
+	return match, nil
+}
+
+// Rerank verifies the candidates, typically the top results of InvertedIndex.Search,
+// and sorts them by NumInliers plus their BoW score. Candidates with less than
+// MinInliers inliers keep their BoW score and come after the verified ones.
+// Candidates that are not stored are dropped.
+func (sr *SpatialReranker) Rerank(frames []CovDetFrameOrientedEllipse, words []uint, candidates []RetrievalMatch, options SpatialVerificationOptions) ([]SpatialMatch, error) {
+	if len(frames) != len(words) {
+		return nil, errors.New("frames and words must have the same length")
+	}
+	options.setDefaults()
+	results := make([]SpatialMatch, 0, len(candidates))
+	for _, candidate := range candidates {
+		imageFrames, ok := sr.frames[candidate.ImageID]
+		if !ok {
+			continue
+		}
+		matches := matchByWord(words, sr.words[candidate.ImageID], options.MaxMatchesPerWord)
+		match := geometricVerification(frames, imageFrames, matches, options)
+		match.ImageID = candidate.ImageID
+		match.BoWScore = candidate.Score
+		match.Score = candidate.Score
+		if match.NumInliers >= options.MinInliers {
+			match.Score += float64(match.NumInliers)
+		}
+		results = append(results, match)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results, nil
+}
+
+// matchByWord returns the (query, image) feature pairs sharing a visual word, skipping
+// words with more than maxPerWord pairs
+func matchByWord(queryWords, imageWords []uint, maxPerWord int) [][2]int {
+	features := map[uint][]int{}
+	for j, word := range imageWords {
+		features[word] = append(features[word], j)
+	}
+	queryFeatures := map[uint][]int{}
+	for i, word := range queryWords {
+		queryFeatures[word] = append(queryFeatures[word], i)
+	}
+	matches := [][2]int{}
+	for i, word := range queryWords {
+		if len(features[word])*len(queryFeatures[word]) > maxPerWord {
+			continue
+		}
+		for _, j := range features[word] {
+			matches = append(matches, [2]int{i, j})
+		}
+	}
+	return matches
+}
+
+// frameToImage returns the affine map taking the query frame f1 onto the image frame f2
+func frameToImage(f1, f2 CovDetFrameOrientedEllipse) ([6]float64, bool) {
+	det := float64(f1.A11)*float64(f1.A22) - float64(f1.A12)*float64(f1.A21)
+	if det == 0 {
+		return [6]float64{}, false
+	}
+	// inverse of A1
+	i11, i12 := float64(f1.A22)/det, -float64(f1.A12)/det
+	i21, i22 := -float64(f1.A21)/det, float64(f1.A11)/det
+	a11 := float64(f2.A11)*i11 + float64(f2.A12)*i21
+	a12 := float64(f2.A11)*i12 + float64(f2.A12)*i22
+	a21 := float64(f2.A21)*i11 + float64(f2.A22)*i21
+	a22 := float64(f2.A21)*i12 + float64(f2.A22)*i22
+	tx := float64(f2.X) - a11*float64(f1.X) - a12*float64(f1.Y)
+	ty := float64(f2.Y) - a21*float64(f1.X) - a22*float64(f1.Y)
+	return [6]float64{a11, a12, tx, a21, a22, ty}, true
+}
+
+// affineInliers returns the pairs mapped by H within tolerance pixels. Matching is kept
+// one to one, a feature that is in several such pairs keeps the one with the smallest
+// residual, so that repeated features do not inflate the inlier count.
+func affineInliers(H [6]float64, frames1, frames2 []CovDetFrameOrientedEllipse, matches [][2]int, tolerance float64) [][2]int {
+	type candidate struct {
+		match    [2]int
+		residual float64
+	}
+	candidates := []candidate{}
+	for _, m := range matches {
+		x, y := float64(frames1[m[0]].X), float64(frames1[m[0]].Y)
+		dx := H[0]*x + H[1]*y + H[2] - float64(frames2[m[1]].X)
+		dy := H[3]*x + H[4]*y + H[5] - float64(frames2[m[1]].Y)
+		if residual := dx*dx + dy*dy; residual < tolerance*tolerance {
+			candidates = append(candidates, candidate{match: m, residual: residual})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].residual < candidates[j].residual })
+	used1, used2 := map[int]bool{}, map[int]bool{}
+	inliers := [][2]int{}
+	for _, c := range candidates {
+		if used1[c.match[0]] || used2[c.match[1]] {
+			continue
+		}
+		used1[c.match[0]], used2[c.match[1]] = true, true
+		inliers = append(inliers, c.match)
+	}
+	sort.Slice(inliers, func(i, j int) bool {
+		if inliers[i][0] != inliers[j][0] {
+			return inliers[i][0] < inliers[j][0]
+		}
+		return inliers[i][1] < inliers[j][1]
+	})
+	return inliers
+}
+
+// fitAffine is the least squares affine map of the pairs, it needs 3 non collinear pairs
+func fitAffine(frames1, frames2 []CovDetFrameOrientedEllipse, matches [][2]int) ([6]float64, bool) {
+	if len(matches) < 3 {
+		return [6]float64{}, false
+	}
+	// normal equations of [x y 1] h = x' and [x y 1] h = y'
+	var AtA [3][3]float64
+	var Atx, Aty [3]float64
+	for _, m := range matches {
+		row := [3]float64{float64(frames1[m[0]].X), float64(frames1[m[0]].Y), 1}
+		for r := 0; r < 3; r++ {
+			for c := 0; c < 3; c++ {
+				AtA[r][c] += row[r] * row[c]
+			}
+			Atx[r] += row[r] * float64(frames2[m[1]].X)
+			Aty[r] += row[r] * float64(frames2[m[1]].Y)
+		}
+	}
+	hx, ok := solve3(AtA, Atx)
+	if !ok {
+		return [6]float64{}, false
+	}
+	hy, _ := solve3(AtA, Aty)
+	return [6]float64{hx[0], hx[1], hx[2], hy[0], hy[1], hy[2]}, true
+}
+
+// solve3 solves a 3x3 linear system by Cramer's rule
+func solve3(A [3][3]float64, b [3]float64) ([3]float64, bool) {
+	det3 := func(M [3][3]float64) float64 {
+		return M[0][0]*(M[1][1]*M[2][2]-M[1][2]*M[2][1]) -
+			M[0][1]*(M[1][0]*M[2][2]-M[1][2]*M[2][0]) +
+			M[0][2]*(M[1][0]*M[2][1]-M[1][1]*M[2][0])
+	}
+	det := det3(A)
+	if math.Abs(det) < 1e-12 {
+		return [3]float64{}, false
+	}
+	var x [3]float64
+	for c := 0; c < 3; c++ {
+		M := A
+		for r := 0; r < 3; r++ {
+			M[r][c] = b[r]
+		}
+		x[c] = det3(M) / det
+	}
+	return x, true
+}
+
+// geometricVerification hypothesizes an affine map from every pair, counts its inliers
+// and refines the best hypotheses by least squares
+func geometricVerification(frames1, frames2 []CovDetFrameOrientedEllipse, matches [][2]int, options SpatialVerificationOptions) SpatialMatch {
+	best := SpatialMatch{Inliers: [][2]int{}}
+	for _, m := range matches {
+		H, ok := frameToImage(frames1[m[0]], frames2[m[1]])
+		if !ok {
+			continue
+		}
+		inliers := affineInliers(H, frames1, frames2, matches, options.Tolerance1)
+		for _, tolerance := range []float64{options.Tolerance2, options.Tolerance3} {
+			refined, ok := fitAffine(frames1, frames2, inliers)
+			if !ok {
+				break
+			}
+			refinedInliers := affineInliers(refined, frames1, frames2, matches, tolerance)
+			if len(refinedInliers) < 3 {
+				break
+			}
+			H, inliers = refined, refinedInliers
+		}
+		if len(inliers) > best.NumInliers {
+			best.NumInliers = len(inliers)
+			best.Transform = H
+			best.Inliers = inliers
+		}
+	}
+	return best
+}
@@ -0,0 +1,110 @@
+package vlfeat
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// transformFrame maps a frame by the affine map H = [a11 a12 tx; a21 a22 ty]
+func transformFrame(H [6]float64, f CovDetFrameOrientedEllipse) CovDetFrameOrientedEllipse {
+	x, y := float64(f.X), float64(f.Y)
+	return CovDetFrameOrientedEllipse{
+		X:   float32(H[0]*x + H[1]*y + H[2]),
+		Y:   float32(H[3]*x + H[4]*y + H[5]),
+		A11: float32(H[0]*float64(f.A11) + H[1]*float64(f.A21)),
+		A12: float32(H[0]*float64(f.A12) + H[1]*float64(f.A22)),
+		A21: float32(H[3]*float64(f.A11) + H[4]*float64(f.A21)),
+		A22: float32(H[3]*float64(f.A12) + H[4]*float64(f.A22)),
+	}
+}
+
+// spatialScene returns 20 query features, an image holding 12 of them moved by H and 8
+// unrelated features far from the others, and the visual words of both
+func spatialScene(H [6]float64) ([]CovDetFrameOrientedEllipse, []uint, []CovDetFrameOrientedEllipse, []uint) {
+	random := rand.New(rand.NewSource(1))
+	frame := func(offset float64) CovDetFrameOrientedEllipse {
+		return CovDetFrameOrientedEllipse{
+			X: float32(offset + random.Float64()*500), Y: float32(offset + random.Float64()*500),
+			A11: 4, A22: 4,
+		}
+	}
+	queryFrames, queryWords := []CovDetFrameOrientedEllipse{}, []uint{}
+	imageFrames, imageWords := []CovDetFrameOrientedEllipse{}, []uint{}
+	for i := 0; i < 20; i++ {
+		queryFrames = append(queryFrames, frame(0))
+		queryWords = append(queryWords, uint(i))
+		if i < 12 {
+			imageFrames = append(imageFrames, transformFrame(H, queryFrames[i]))
+		} else {
+			imageFrames = append(imageFrames, frame(2000))
+		}
+		imageWords = append(imageWords, uint(i))
+	}
+	return queryFrames, queryWords, imageFrames, imageWords
+}
+
+func TestSpatialVerify(t *testing.T) {
+	H := [6]float64{0.9, -0.3, 40, 0.3, 0.9, -25}
+	queryFrames, queryWords, imageFrames, imageWords := spatialScene(H)
+	sr := NewSpatialReranker()
+	if err := sr.Add(7, imageFrames, imageWords); err != nil {
+		t.Fatal(err)
+	}
+	match, err := sr.Verify(queryFrames, queryWords, 7, SpatialVerificationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match.ImageID != 7 || match.NumInliers != 12 {
+		t.Errorf("image %d with %d inliers, want image 7 with 12", match.ImageID, match.NumInliers)
+	}
+	for i := range H {
+		if math.Abs(match.Transform[i]-H[i]) > 1e-3*math.Max(1, math.Abs(H[i])) {
+			t.Errorf("transform = %v, want %v", match.Transform, H)
+			break
+		}
+	}
+	for _, inlier := range match.Inliers {
+		if inlier[0] != inlier[1] || inlier[0] >= 12 {
+			t.Errorf("pair %v is not a true correspondence", inlier)
+		}
+	}
+}
+
+func TestSpatialInliersOneToOne(t *testing.T) {
+	H := [6]float64{1, 0, 10, 0, 1, 10}
+	queryFrames, queryWords, imageFrames, imageWords := spatialScene(H)
+	// the image repeats its first feature 3 times with the same word
+	for i := 0; i < 3; i++ {
+		imageFrames = append(imageFrames, imageFrames[0])
+		imageWords = append(imageWords, imageWords[0])
+	}
+	sr := NewSpatialReranker()
+	sr.Add(1, imageFrames, imageWords)
+	match, err := sr.Verify(queryFrames, queryWords, 1, SpatialVerificationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match.NumInliers != 12 {
+		t.Errorf("%d inliers, want 12 with the repeated feature counted once", match.NumInliers)
+	}
+}
+
+func TestSpatialRerank(t *testing.T) {
+	H := [6]float64{1.1, 0, -5, 0, 1.1, 3}
+	queryFrames, queryWords, imageFrames, imageWords := spatialScene(H)
+	sr := NewSpatialReranker()
+	sr.Add(1, imageFrames[12:], imageWords[12:])
+	sr.Add(2, imageFrames, imageWords)
+	candidates := []RetrievalMatch{{ImageID: 1, Score: 0.9}, {ImageID: 2, Score: 0.5}, {ImageID: 3, Score: 0.4}}
+	results, err := sr.Rerank(queryFrames, queryWords, candidates, SpatialVerificationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].ImageID != 2 || results[1].ImageID != 1 {
+		t.Fatalf("results = %v, want image 2 then 1, image 3 is not stored", results)
+	}
+	if results[0].Score != 0.5+12 || results[1].Score != 0.9 {
+		t.Errorf("scores %g and %g, want 12.5 and 0.9", results[0].Score, results[1].Score)
+	}
+}
@@ -0,0 +1,390 @@
+package vlfeat
+
+/*
+#include <stdlib.h>
+#include <svm.h>
+
+extern void goSvmDiagnostic(VlSvm *svm, void *data);
+*/
+import "C"
+import (
+	"errors"
+	"sync"
+	"unsafe"
+)
+
+type VlSvmSolverType int
+
+const (
+	VlSvmSolverNone VlSvmSolverType = 0
+	VlSvmSolverSgd  VlSvmSolverType = 1
+	VlSvmSolverSdca VlSvmSolverType = 2
+)
+
+type VlSvmLossType int
+
+const (
+	VlSvmLossHinge    VlSvmLossType = 0
+	VlSvmLossHinge2   VlSvmLossType = 1
+	VlSvmLossL1       VlSvmLossType = 2
+	VlSvmLossL2       VlSvmLossType = 3
+	VlSvmLossLogistic VlSvmLossType = 4
+)
+
+type VlSvmSolverStatus int
+
+const (
+	VlSvmStatusTraining                VlSvmSolverStatus = 1
+	VlSvmStatusConverged               VlSvmSolverStatus = 2
+	VlSvmStatusMaxNumIterationsReached VlSvmSolverStatus = 3
+)
+
+type SvmStatistics struct {
+	Status          VlSvmSolverStatus `json:"status"`
+	Iteration       uint              `json:"iteration"`
+	Epoch           uint              `json:"epoch"`
+	Objective       float64           `json:"objective"`
+	Regularizer     float64           `json:"regularizer"`
+	Loss            float64           `json:"loss"`
+	DualObjective   float64           `json:"dualObjective"`
+	DualLoss        float64           `json:"dualLoss"`
+	DualityGap      float64           `json:"dualityGap"`
+	ScoresVariation float64           `json:"scoresVariation"`
+	ElapsedTime     float64           `json:"elapsedTime"`
+}
+
+// Svm trains a linear SVM on numData data of the given dimension. vl_svm keeps
+// pointers to the data, the labels and the weights, which are copied to C memory
+// freed by Delete, except for data shared through SvmData.
+type Svm struct {
+	p       *C.VlSvm
+	data    *C.double // nil when the data is shared
+	labels  *C.double
+	weights *C.double
+	// diagnostic id registered in svmDiagnostics, stored in C memory
+	diagnostic *C.int
+}
+
+// the diagnostic functions are looked up by id since C cannot keep Go pointers
+var (
+	svmDiagnosticsMutex sync.Mutex
+	svmDiagnostics      = map[int]func(stats SvmStatistics){}
+	svmDiagnosticsNext  = 0
+)
+
+//export goSvmDiagnostic
+func goSvmDiagnostic(svm *C.VlSvm, data unsafe.Pointer) {
+	id := int(*(*C.int)(data))
+	svmDiagnosticsMutex.Lock()
+	fn := svmDiagnostics[id]
+	svmDiagnosticsMutex.Unlock()
+	if fn != nil {
+		fn(toSvmStatistics(C.vl_svm_get_statistics(svm)))
+	}
+}
+
+func toSvmStatistics(cStats *C.VlSvmStatistics) SvmStatistics {
+	return SvmStatistics{
+		Status:          VlSvmSolverStatus(cStats.status),
+		Iteration:       uint(cStats.iteration),
+		Epoch:           uint(cStats.epoch),
+		Objective:       float64(cStats.objective),
+		Regularizer:     float64(cStats.regularizer),
+		Loss:            float64(cStats.loss),
+		DualObjective:   float64(cStats.dualObjective),
+		DualLoss:        float64(cStats.dualLoss),
+		DualityGap:      float64(cStats.dualityGap),
+		ScoresVariation: float64(cStats.scoresVariation),
+		ElapsedTime:     float64(cStats.elapsedTime),
+	}
+}
+
+// toCDoubleArray copies values to memory allocated with malloc
+func toCDoubleArray(values []float64) *C.double {
+	n := len(values)
+	p := (*C.double)(C.malloc(C.size_t(n) * C.size_t(unsafe.Sizeof(C.double(0)))))
+	cValues := (*[1 << 30]C.double)(unsafe.Pointer(p))[:n:n]
+	for i, v := range values {
+		cValues[i] = C.double(v)
+	}
+	return p
+}
+
+func fromCDoubleArray(p *C.double, n int) []float64 {
+	values := make([]float64, n)
+	if p == nil || n == 0 {
+		return values
+	}
+	cValues := (*[1 << 30]C.double)(unsafe.Pointer(p))[:n:n]
+	for i, v := range cValues {
+		values[i] = float64(v)
+	}
+	return values
+}
+
+/* Create and destroy */
+
+// SvmData is a data matrix copied once to C memory, to train several Svm on the same
+// data with different labels, as one-vs-rest classifiers do. It must outlive the Svm
+// created from it with NewSvmFromData and is freed by Delete.
+type SvmData struct {
+	p         *C.double
+	dimension uint
+	numData   uint
+}
+
+// NewSvmData copies numData rows of dimension values to C memory
+func NewSvmData(data []float64, dimension, numData uint) (SvmData, error) {
+	if dimension == 0 || numData == 0 {
+		return SvmData{}, errors.New("dimension and numData must be positive")
+	}
+	if len(data) < int(dimension*numData) {
+		return SvmData{}, errors.New("data must hold numData x dimension values")
+	}
+	return SvmData{p: toCDoubleArray(data[:dimension*numData]), dimension: dimension, numData: numData}, nil
+}
+
+func (data *SvmData) Delete() {
+	C.free(unsafe.Pointer(data.p))
+	data.p = nil
+}
+
+// https://www.vlfeat.org/api/svm_8h.html
+//
+// data holds numData rows of dimension values and labels numData values in {-1, 1}.
+// lambda is the regularization strength.
+func NewSvm(solver VlSvmSolverType, data []float64, dimension, numData uint, labels []float64, lambda float64) (Svm, error) {
+	svmData, err := NewSvmData(data, dimension, numData)
+	if err != nil {
+		return Svm{}, err
+	}
+	svm, err := NewSvmFromData(solver, &svmData, labels, lambda)
+	if err != nil {
+		svmData.Delete()
+		return Svm{}, err
+	}
+	// the copy of the data belongs to this Svm
+	svm.data = svmData.p
+	return svm, nil
+}
+
+// NewSvmFromData is NewSvm on data shared with other Svm, which Delete does not free.
+func NewSvmFromData(solver VlSvmSolverType, data *SvmData, labels []float64, lambda float64) (Svm, error) {
+	if data.p == nil {
+		return Svm{}, errors.New("SvmData was deleted")
+	}
+	if len(labels) < int(data.numData) {
+		return Svm{}, errors.New("labels must hold numData values")
+	}
+	if solver != VlSvmSolverSgd && solver != VlSvmSolverSdca {
+		return Svm{}, errors.New("Svm just support VlSvmSolverSgd and VlSvmSolverSdca")
+	}
+	svm := Svm{labels: toCDoubleArray(labels[:data.numData])}
+	svm.p = C.vl_svm_new(C.VlSvmSolverType(solver), data.p, C.uint(data.dimension), C.uint(data.numData), svm.labels, C.double(lambda))
+	return svm, nil
+}
+
+// Delete frees the solver, the copies of the data and the diagnostic function
+func (svm *Svm) Delete() {
+	C.vl_svm_delete(svm.p)
+	C.free(unsafe.Pointer(svm.data))
+	C.free(unsafe.Pointer(svm.labels))
+	if svm.weights != nil {
+		C.free(unsafe.Pointer(svm.weights))
+	}
+	svm.clearDiagnostic()
+}
+
+/* Process data */
+
+// Train runs the solver until convergence or the maximum number of iterations.
+func (svm *Svm) Train() SvmStatistics {
+	C.vl_svm_train(svm.p)
+	return svm.GetStatistics()
+}
+
+// Score returns the scores w x + b of numData data of the model dimension
+func (svm *Svm) Score(data []float64, numData uint) ([]float64, error) {
+	dimension := svm.GetDimension()
+	if len(data) < int(dimension*numData) {
+		return nil, errors.New("data must hold numData x dimension values")
+	}
+	model := svm.GetModel()
+	bias := svm.GetBias()
+	scores := make([]float64, numData)
+	for i := range scores {
+		score := bias
+		for j, w := range model {
+			score += w * data[i*int(dimension)+j]
+		}
+		scores[i] = score
+	}
+	return scores, nil
+}
+
+/* Retrieve data and parameters */
+
+// GetModel returns the weight vector w of the model
+func (svm *Svm) GetModel() []float64 {
+	return fromCDoubleArray(C.vl_svm_get_model(svm.p), int(svm.GetDimension()))
+}
+
+// GetBias returns the bias b of the scores w x + b
+func (svm *Svm) GetBias() float64 {
+	return float64(C.vl_svm_get_bias(svm.p))
+}
+
+func (svm *Svm) GetDimension() uint {
+	return uint(C.vl_svm_get_dimension(svm.p))
+}
+
+func (svm *Svm) GetNumData() uint {
+	return uint(C.vl_svm_get_num_data(svm.p))
+}
+
+func (svm *Svm) GetEpsilon() float64 {
+	return float64(C.vl_svm_get_epsilon(svm.p))
+}
+
+func (svm *Svm) GetBiasLearningRate() float64 {
+	return float64(C.vl_svm_get_bias_learning_rate(svm.p))
+}
+
+func (svm *Svm) GetMaxNumIterations() uint {
+	return uint(C.vl_svm_get_max_num_iterations(svm.p))
+}
+
+func (svm *Svm) GetDiagnosticFrequency() uint {
+	return uint(C.vl_svm_get_diagnostic_frequency(svm.p))
+}
+
+func (svm *Svm) GetSolver() VlSvmSolverType {
+	return VlSvmSolverType(C.vl_svm_get_solver(svm.p))
+}
+
+func (svm *Svm) GetBiasMultiplier() float64 {
+	return float64(C.vl_svm_get_bias_multiplier(svm.p))
+}
+
+func (svm *Svm) GetLambda() float64 {
+	return float64(C.vl_svm_get_lambda(svm.p))
+}
+
+func (svm *Svm) GetIterationNumber() uint {
+	return uint(C.vl_svm_get_iteration_number(svm.p))
+}
+
+func (svm *Svm) GetLoss() VlSvmLossType {
+	return VlSvmLossType(C.vl_svm_get_loss(svm.p))
+}
+
+// GetScores returns the scores of the training data computed by the last diagnostic
+func (svm *Svm) GetScores() []float64 {
+	return fromCDoubleArray(C.vl_svm_get_scores(svm.p), int(svm.GetNumData()))
+}
+
+// GetWeights returns the per sample weights, nil when they are not set
+func (svm *Svm) GetWeights() []float64 {
+	p := C.vl_svm_get_weights(svm.p)
+	if p == nil {
+		return nil
+	}
+	return fromCDoubleArray(p, int(svm.GetNumData()))
+}
+
+func (svm *Svm) GetStatistics() SvmStatistics {
+	return toSvmStatistics(C.vl_svm_get_statistics(svm.p))
+}
+
+/* Set parameters */
+
+func (svm *Svm) SetEpsilon(epsilon float64) {
+	C.vl_svm_set_epsilon(svm.p, C.double(epsilon))
+}
+
+func (svm *Svm) SetBiasLearningRate(rate float64) {
+	C.vl_svm_set_bias_learning_rate(svm.p, C.double(rate))
+}
+
+func (svm *Svm) SetMaxNumIterations(maxNumIterations uint) {
+	C.vl_svm_set_max_num_iterations(svm.p, C.uint(maxNumIterations))
+}
+
+func (svm *Svm) SetDiagnosticFrequency(frequency uint) {
+	C.vl_svm_set_diagnostic_frequency(svm.p, C.uint(frequency))
+}
+
+func (svm *Svm) SetIterationNumber(n uint) {
+	C.vl_svm_set_iteration_number(svm.p, C.uint(n))
+}
+
+func (svm *Svm) SetLambda(lambda float64) {
+	C.vl_svm_set_lambda(svm.p, C.double(lambda))
+}
+
+// SetBiasMultiplier sets the constant feature appended to the data, 0 disables the bias
+func (svm *Svm) SetBiasMultiplier(multiplier float64) {
+	C.vl_svm_set_bias_multiplier(svm.p, C.double(multiplier))
+}
+
+func (svm *Svm) SetLoss(loss VlSvmLossType) {
+	C.vl_svm_set_loss(svm.p, C.VlSvmLossType(loss))
+}
+
+// SetModel sets the initial weight vector, of the model dimension
+func (svm *Svm) SetModel(model []float64) error {
+	if len(model) != int(svm.GetDimension()) {
+		return errors.New("model must have dimension values")
+	}
+	cModel := toCDoubleArray(model)
+	defer C.free(unsafe.Pointer(cModel))
+	C.vl_svm_set_model(svm.p, cModel)
+	return nil
+}
+
+func (svm *Svm) SetBias(bias float64) {
+	C.vl_svm_set_bias(svm.p, C.double(bias))
+}
+
+// SetWeights sets a non negative weight per training sample, scaling its loss
+func (svm *Svm) SetWeights(weights []float64) error {
+	if len(weights) != int(svm.GetNumData()) {
+		return errors.New("weights must have numData values")
+	}
+	cWeights := toCDoubleArray(weights)
+	C.vl_svm_set_weights(svm.p, cWeights)
+	if svm.weights != nil {
+		C.free(unsafe.Pointer(svm.weights))
+	}
+	svm.weights = cWeights
+	return nil
+}
+
+func (svm *Svm) clearDiagnostic() {
+	if svm.diagnostic == nil {
+		return
+	}
+	svmDiagnosticsMutex.Lock()
+	delete(svmDiagnostics, int(*svm.diagnostic))
+	svmDiagnosticsMutex.Unlock()
+	C.free(unsafe.Pointer(svm.diagnostic))
+	svm.diagnostic = nil
+}
+
+// SetDiagnosticFunction calls fn with the statistics every GetDiagnosticFrequency
+// iterations during Train, reporting the primal and dual objectives. nil removes it.
+func (svm *Svm) SetDiagnosticFunction(fn func(stats SvmStatistics)) {
+	svm.clearDiagnostic()
+	if fn == nil {
+		C.vl_svm_set_diagnostic_function(svm.p, nil, nil)
+		return
+	}
+	svmDiagnosticsMutex.Lock()
+	id := svmDiagnosticsNext
+	svmDiagnosticsNext++
+	svmDiagnostics[id] = fn
+	svmDiagnosticsMutex.Unlock()
+	svm.diagnostic = (*C.int)(C.malloc(C.size_t(unsafe.Sizeof(C.int(0)))))
+	*svm.diagnostic = C.int(id)
+	C.vl_svm_set_diagnostic_function(svm.p, C.VlSvmDiagnosticFunction(C.goSvmDiagnostic), unsafe.Pointer(svm.diagnostic))
+}
@@ -0,0 +1,45 @@
+package vlfeat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCDoubleArrayRoundTrip(t *testing.T) {
+	values := []float64{1.5, -2, 0, 1e300}
+	p := toCDoubleArray(values)
+	if got := fromCDoubleArray(p, len(values)); !reflect.DeepEqual(got, values) {
+		t.Errorf("copied %v, want %v", got, values)
+	}
+	if got := fromCDoubleArray(nil, 3); !reflect.DeepEqual(got, []float64{0, 0, 0}) {
+		t.Errorf("nil array copied to %v", got)
+	}
+	data := SvmData{p: p, dimension: 2, numData: 2}
+	data.Delete()
+	if data.p != nil {
+		t.Error("Delete kept the pointer to freed memory")
+	}
+}
+
+func TestSvmDataValidation(t *testing.T) {
+	if _, err := NewSvmData([]float64{1, 2, 3}, 2, 2); err == nil {
+		t.Error("NewSvmData accepted 3 values for 2 x 2")
+	}
+	if _, err := NewSvmData(nil, 0, 1); err == nil {
+		t.Error("NewSvmData accepted dimension 0")
+	}
+	data, err := NewSvmData([]float64{1, 2, 3, 4}, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSvmFromData(VlSvmSolverSgd, &data, []float64{1}, 0.1); err == nil {
+		t.Error("NewSvmFromData accepted a single label for 2 samples")
+	}
+	if _, err := NewSvmFromData(VlSvmSolverNone, &data, []float64{1, -1}, 0.1); err == nil {
+		t.Error("NewSvmFromData accepted VlSvmSolverNone")
+	}
+	data.Delete()
+	if _, err := NewSvmFromData(VlSvmSolverSgd, &data, []float64{1, -1}, 0.1); err == nil {
+		t.Error("NewSvmFromData accepted deleted data")
+	}
+}
@@ -0,0 +1,147 @@
+package vlfeat
+
+/*
+#include <stdlib.h>
+#include <kmeans.h>
+#include <gmm.h>
+*/
+import "C"
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrStopTraining can be returned by a TrainingCallback to stop training early
+// without reporting an error.
+var ErrStopTraining = errors.New("training stopped by callback")
+
+// TrainingProgress is reported after every iteration. Objective is the energy for
+// Kmeans and the log-likelihood for GMM.
+type TrainingProgress struct {
+	Iteration uint          `json:"iteration"`
+	Objective float64       `json:"objective"`
+	Elapsed   time.Duration `json:"elapsed"`
+}
+
+type TrainingCallback func(progress TrainingProgress) error
+
+// TrainingOptions control the iteration-level training drivers.
+// MaxNumIterations 0 means the value already set on the Kmeans or GMM object.
+// Training stops early once the relative change of the objective stays below
+// MinRelativeChange for Patience consecutive iterations.
+type TrainingOptions struct {
+	MaxNumIterations  uint
+	MinRelativeChange float64
+	Patience          uint
+	Callback          TrainingCallback
+}
+
+// runTraining runs step until the options, the callback or ctx stop it
+func runTraining(ctx context.Context, options TrainingOptions, maxNumIterations uint, step func() (float64, error)) (float64, error) {
+	if options.MaxNumIterations > 0 {
+		maxNumIterations = options.MaxNumIterations
+	}
+	patience := options.Patience
+	if patience == 0 {
+		patience = 1
+	}
+	start := time.Now()
+	objective := 0.0
+	stalled := uint(0)
+	for iteration := uint(0); iteration < maxNumIterations; iteration++ {
+		if err := ctx.Err(); err != nil {
+			return objective, err
+		}
+		current, err := step()
+		if err != nil {
+			return current, err
+		}
+		if options.Callback != nil {
+			err := options.Callback(TrainingProgress{
+				Iteration: iteration,
+				Objective: current,
+				Elapsed:   time.Since(start),
+			})
+			if err == ErrStopTraining {
+				return current, nil
+			}
+			if err != nil {
+				return current, err
+			}
+		}
+		if iteration > 0 && options.MinRelativeChange > 0 {
+			change := math.Abs(current-objective) / math.Max(math.Abs(objective), math.SmallestNonzeroFloat64)
+			if change < options.MinRelativeChange {
+				stalled++
+			} else {
+				stalled = 0
+			}
+		}
+		objective = current
+		if stalled >= patience {
+			break
+		}
+	}
+	return objective, nil
+}
+
+// ClusterContext works like Cluster but runs one refinement iteration at a time, so that
+// progress can be reported and ctx can cancel training. Only one repetition is run.
+func (kmeans *Kmeans) ClusterContext(ctx context.Context, data interface{}, dimension, numData, numCenters uint, options TrainingOptions) (float64, error) {
+	var err error
+	if kmeans.GetInitialization() == VlKMeansPlusPlus {
+		err = kmeans.InitCentersPlusPlus(data, dimension, numData, numCenters)
+	} else {
+		err = kmeans.InitCentersWithRandData(data, dimension, numData, numCenters)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return kmeans.RefineCentersContext(ctx, data, numData, options)
+}
+
+// RefineCentersContext works like RefineCenters but runs one iteration at a time from the
+// current centers, reporting progress and honouring ctx.
+func (kmeans *Kmeans) RefineCentersContext(ctx context.Context, data interface{}, numData uint, options TrainingOptions) (float64, error) {
+	maxNumIterations := kmeans.GetMaxNumIterations()
+	kmeans.SetMaxNumIterations(1)
+	defer kmeans.SetMaxNumIterations(maxNumIterations)
+
+	vltype := kmeans.GetDataType()
+	dataPtr, _, err := ToCVlTypeArrayPtr(data, vltype)
+	if err != nil {
+		return 0, err
+	}
+	return runTraining(ctx, options, maxNumIterations, func() (float64, error) {
+		return float64(C.vl_kmeans_refine_centers(kmeans.p, dataPtr, C.uint(numData))), nil
+	})
+}
+
+// ClusterContext works like Cluster but runs EM one iteration at a time, so that
+// progress can be reported and ctx can cancel training. Only one repetition is run.
+func (gmm *GMM) ClusterContext(ctx context.Context, data interface{}, options TrainingOptions) (float64, error) {
+	if err := gmm.Init(data); err != nil {
+		return 0, err
+	}
+	return gmm.EmContext(ctx, data, options)
+}
+
+// EmContext works like Em but runs one iteration at a time from the current parameters,
+// reporting the log-likelihood and honouring ctx.
+func (gmm *GMM) EmContext(ctx context.Context, data interface{}, options TrainingOptions) (float64, error) {
+	maxNumIterations := uint(gmm.GetMaxNumIterations())
+	gmm.SetMaxNumIterations(1)
+	defer gmm.SetMaxNumIterations(maxNumIterations)
+
+	vltype := gmm.GetDataType()
+	dataPtr, length, err := ToCVlTypeArrayPtr(data, vltype)
+	if err != nil {
+		return 0, err
+	}
+	numData := uint(length) / gmm.GetDimension()
+	return runTraining(ctx, options, maxNumIterations, func() (float64, error) {
+		return float64(C.vl_gmm_em(gmm.p, dataPtr, C.uint(numData))), nil
+	})
+}
@@ -0,0 +1,92 @@
+package vlfeat
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// countingStep returns a step whose objective follows objectives, then stays at the
+// last one, and the number of calls made
+func countingStep(objectives []float64) (func() (float64, error), *int) {
+	calls := 0
+	return func() (float64, error) {
+		i := calls
+		if i >= len(objectives) {
+			i = len(objectives) - 1
+		}
+		calls++
+		return objectives[i], nil
+	}, &calls
+}
+
+func TestRunTrainingIterations(t *testing.T) {
+	step, calls := countingStep([]float64{10, 5, 2})
+	objective, err := runTraining(context.Background(), TrainingOptions{}, 4, step)
+	if err != nil || *calls != 4 || objective != 2 {
+		t.Errorf("default: %d calls, objective %g, error %v; want 4 calls and 2", *calls, objective, err)
+	}
+	step, calls = countingStep([]float64{10, 5, 2})
+	runTraining(context.Background(), TrainingOptions{MaxNumIterations: 2}, 4, step)
+	if *calls != 2 {
+		t.Errorf("MaxNumIterations 2 made %d calls", *calls)
+	}
+}
+
+func TestRunTrainingPatience(t *testing.T) {
+	// the objective stops changing after the third iteration
+	objectives := []float64{100, 50, 40, 40, 40, 40, 40, 40}
+	for patience, want := range map[uint]int{1: 4, 3: 6} {
+		step, calls := countingStep(objectives)
+		options := TrainingOptions{MinRelativeChange: 1e-3, Patience: patience}
+		if _, err := runTraining(context.Background(), options, 100, step); err != nil {
+			t.Fatal(err)
+		}
+		if *calls != want {
+			t.Errorf("patience %d: %d iterations, want %d", patience, *calls, want)
+		}
+	}
+}
+
+func TestRunTrainingCallback(t *testing.T) {
+	step, calls := countingStep([]float64{3, 2, 1})
+	progress := []TrainingProgress{}
+	options := TrainingOptions{Callback: func(p TrainingProgress) error {
+		progress = append(progress, p)
+		if p.Iteration == 1 {
+			return ErrStopTraining
+		}
+		return nil
+	}}
+	objective, err := runTraining(context.Background(), options, 10, step)
+	if err != nil || objective != 2 || *calls != 2 {
+		t.Errorf("stopped with %d calls, objective %g, error %v; want 2 calls and 2", *calls, objective, err)
+	}
+	if len(progress) != 2 || progress[0].Iteration != 0 || progress[0].Objective != 3 {
+		t.Errorf("progress = %v", progress)
+	}
+
+	failure := errors.New("failure")
+	options.Callback = func(TrainingProgress) error { return failure }
+	step, _ = countingStep([]float64{1})
+	if _, err := runTraining(context.Background(), options, 10, step); err != failure {
+		t.Errorf("callback error not returned, got %v", err)
+	}
+}
+
+func TestRunTrainingCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	step, calls := countingStep([]float64{1})
+	options := TrainingOptions{Callback: func(p TrainingProgress) error {
+		if p.Iteration == 2 {
+			cancel()
+		}
+		return nil
+	}}
+	if _, err := runTraining(ctx, options, 10, step); err != context.Canceled {
+		t.Errorf("error %v, want context.Canceled", err)
+	}
+	if *calls != 3 {
+		t.Errorf("%d iterations ran, want 3", *calls)
+	}
+}
@@ -0,0 +1,97 @@
+package vlfeat
+
+import (
+	"errors"
+	"math"
+)
+
+// VectorIndex is an image database of global descriptors such as VladEncode
+// encodings, searched exhaustively by cosine similarity.
+type VectorIndex struct {
+	dimension uint
+	vectors   map[uint][]float64
+}
+
+// NewVectorIndex returns an empty index of vectors of the given dimension.
+func NewVectorIndex(dimension uint) VectorIndex {
+	return VectorIndex{
+		dimension: dimension,
+		vectors:   map[uint][]float64{},
+	}
+}
+
+// normalizeVector returns a copy of vector with unit L2 norm
+func normalizeVector(vector []float64) []float64 {
+	norm := 0.0
+	for _, v := range vector {
+		norm += v * v
+	}
+	normalized := make([]float64, len(vector))
+	if norm == 0 {
+		return normalized
+	}
+	norm = math.Sqrt(norm)
+	for i, v := range vector {
+		normalized[i] = v / norm
+	}
+	return normalized
+}
+
+/* Manage the database */
+
+// Add indexes the vector of image id, replacing the image if it exists. The index
+// keeps an L2 normalized copy.
+func (index *VectorIndex) Add(id uint, vector []float64) error {
+	if len(vector) != int(index.dimension) {
+		return errors.New("vector must have the dimension of the index")
+	}
+	index.vectors[id] = normalizeVector(vector)
+	return nil
+}
+
+// Remove removes image id from the index, it returns false if it was not indexed.
+func (index *VectorIndex) Remove(id uint) bool {
+	if _, ok := index.vectors[id]; !ok {
+		return false
+	}
+	delete(index.vectors, id)
+	return true
+}
+
+func (index *VectorIndex) GetDimension() uint {
+	return index.dimension
+}
+
+func (index *VectorIndex) GetNumImages() uint {
+	return uint(len(index.vectors))
+}
+
+// GetVector returns a copy of the normalized vector of image id
+func (index *VectorIndex) GetVector(id uint) ([]float64, bool) {
+	vector, ok := index.vectors[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]float64{}, vector...), true
+}
+
+/* Search */
+
+// Search scores every image by the dot product of its normalized vector with query,
+// the cosine similarity when query is normalized, and returns the topK best matches
+// (all of them when topK is 0), best first.
+func (index *VectorIndex) Search(query []float64, topK int) ([]RetrievalMatch, error) {
+	if len(query) != int(index.dimension) {
+		return nil, errors.New("query must have the dimension of the index")
+	}
+	query = normalizeVector(query)
+	scores := make(map[uint]float64, len(index.vectors))
+	for id, vector := range index.vectors {
+		score := 0.0
+		for i, v := range vector {
+			score += v * query[i]
+		}
+		scores[id] = score
+	}
+	return sortRetrievalMatches(scores, topK), nil
+}
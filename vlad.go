@@ -5,7 +5,6 @@ package vlfeat
 #include <vlad.h>
 */
 import "C"
-import "unsafe"
 
 type VladFlag int
 
@@ -20,7 +19,10 @@ const (
 func VladEncode(dataType VlType, means interface{}, dimension, numClusters uint, data interface{}, numData uint, assignments interface{}, flag VladFlag) ([]float64, error) {
 	encLength := int(dimension * numClusters)
 	enc := make([]float64, encLength)
-	cEnc := make([]C.double, encLength)
+	encPtr, _, err := ToCVlTypeArrayPtr(enc, dataType)
+	if err != nil {
+		return enc, err
+	}
 	meansPtr, _, err := ToCVlTypeArrayPtr(means, dataType)
 	if err != nil {
 		return enc, err
@@ -33,10 +35,6 @@ func VladEncode(dataType VlType, means interface{}, dimension, numClusters uint,
 	if err != nil {
 		return enc, err
 	}
-	encPtr := unsafe.Pointer(&cEnc)
-	C.vl_vlad_encode(encPtr, C.vl_type(VlTypeFloat), meansPtr, C.uint(dimension), C.uint(numClusters), dataPtr, C.uint(numData), assignmentsPtr, C.int(flag))
-	for i, des := range cEnc {
-		enc[i] = float64(des)
-	}
-	return enc, nil
+	C.vl_vlad_encode(encPtr, C.vl_type(dataType), meansPtr, C.uint(dimension), C.uint(numClusters), dataPtr, C.uint(numData), assignmentsPtr, C.int(flag))
+	return fromCVlTypeArrayPtr(encPtr, dataType, encLength), nil
 }
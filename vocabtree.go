@@ -0,0 +1,198 @@
+package vlfeat
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// VocabularyTreeMatch is a database image scored against a query.
+// Distance is the L1 distance between the normalized TF-IDF vectors, in [0, 2],
+// lower is better.
+type VocabularyTreeMatch struct {
+	ImageID  uint    `json:"imageId"`
+	Distance float64 `json:"distance"`
+}
+
+// VocabularyTree is a Nister-Stewenius vocabulary tree index on top of a trained HIKM.
+// Every node of the tree is a visual word with its own inverted file; descriptors
+// vote for all the nodes on their path and nodes are weighted by their IDF.
+type VocabularyTree struct {
+	hikm  *HIKM
+	K     uint64
+	depth uint
+
+	// node -> image -> number of descriptors through the node
+	invertedFiles map[uint64]map[uint]float64
+	// image -> node -> number of descriptors through the node
+	images map[uint]map[uint64]float64
+	// image -> L1 norm of its weighted vector, recomputed when the database changes
+	norms map[uint]float64
+	dirty bool
+}
+
+// NewVocabularyTree returns an empty index using the trained tree hikm.
+func NewVocabularyTree(hikm *HIKM) VocabularyTree {
+	return VocabularyTree{
+		hikm:          hikm,
+		K:             uint64(hikm.GetK()),
+		depth:         hikm.GetDepth(),
+		invertedFiles: map[uint64]map[uint]float64{},
+		images:        map[uint]map[uint64]float64{},
+		norms:         map[uint]float64{},
+	}
+}
+
+// nodeCounts pushes N descriptors down the tree and counts the descriptors through
+// every node. Nodes are numbered as in a complete K-ary tree: the root is 0 and the
+// children of n are n*K+1 ... n*K+K. The root is not counted.
+func (vt *VocabularyTree) nodeCounts(descriptors []uint8, N uint) map[uint64]float64 {
+	return vt.pathCounts(vt.hikm.Push(descriptors, N), N)
+}
+
+// pathCounts counts the descriptors through every node given their N paths of depth
+// branches, as returned by HIKM.Push
+func (vt *VocabularyTree) pathCounts(paths []uint, N uint) map[uint64]float64 {
+	depth := int(vt.depth)
+	counts := map[uint64]float64{}
+	for i := 0; i < int(N); i++ {
+		node := uint64(0)
+		for _, branch := range paths[i*depth : (i+1)*depth] {
+			node = node*vt.K + uint64(branch) + 1
+			counts[node]++
+		}
+	}
+	return counts
+}
+
+// weight is the IDF of a node, ln(number of images / number of images through the node)
+func (vt *VocabularyTree) weight(node uint64) float64 {
+	n := len(vt.invertedFiles[node])
+	if n == 0 {
+		return 0
+	}
+	return math.Log(float64(len(vt.images)) / float64(n))
+}
+
+func (vt *VocabularyTree) updateNorms() {
+	if !vt.dirty {
+		return
+	}
+	for id, counts := range vt.images {
+		norm := 0.0
+		for node, count := range counts {
+			norm += count * vt.weight(node)
+		}
+		vt.norms[id] = norm
+	}
+	vt.dirty = false
+}
+
+/* Manage the database */
+
+// AddImage indexes the N descriptors of image id, replacing the image if it exists.
+func (vt *VocabularyTree) AddImage(id uint, descriptors []uint8, N uint) error {
+	if N == 0 {
+		return errors.New("image must have at least one descriptor")
+	}
+	vt.RemoveImage(id)
+	vt.addCounts(id, vt.nodeCounts(descriptors, N))
+	return nil
+}
+
+func (vt *VocabularyTree) addCounts(id uint, counts map[uint64]float64) {
+	for node, count := range counts {
+		file, ok := vt.invertedFiles[node]
+		if !ok {
+			file = map[uint]float64{}
+			vt.invertedFiles[node] = file
+		}
+		file[id] = count
+	}
+	vt.images[id] = counts
+	vt.dirty = true
+}
+
+// RemoveImage removes image id from the index, it returns false if it was not indexed.
+func (vt *VocabularyTree) RemoveImage(id uint) bool {
+	counts, ok := vt.images[id]
+	if !ok {
+		return false
+	}
+	for node := range counts {
+		file := vt.invertedFiles[node]
+		delete(file, id)
+		if len(file) == 0 {
+			delete(vt.invertedFiles, node)
+		}
+	}
+	delete(vt.images, id)
+	delete(vt.norms, id)
+	vt.dirty = true
+	return true
+}
+
+func (vt *VocabularyTree) GetNumImages() uint {
+	return uint(len(vt.images))
+}
+
+// GetNumNodes returns the number of non-empty inverted files
+func (vt *VocabularyTree) GetNumNodes() uint {
+	return uint(len(vt.invertedFiles))
+}
+
+/* Query */
+
+// Query scores the database images against the N query descriptors and returns the
+// numResults best matches (all of them when numResults is 0), best first. Images
+// sharing no node with the query have distance 2 and are not returned.
+func (vt *VocabularyTree) Query(descriptors []uint8, N uint, numResults int) []VocabularyTreeMatch {
+	if N == 0 || len(vt.images) == 0 {
+		return []VocabularyTreeMatch{}
+	}
+	return vt.query(vt.nodeCounts(descriptors, N), numResults)
+}
+
+// query scores the images against the node counts of the query descriptors
+func (vt *VocabularyTree) query(query map[uint64]float64, numResults int) []VocabularyTreeMatch {
+	vt.updateNorms()
+	queryNorm := 0.0
+	for node, count := range query {
+		queryNorm += count * vt.weight(node)
+	}
+	if queryNorm == 0 {
+		return []VocabularyTreeMatch{}
+	}
+
+	// |q - d|_1 = 2 + sum over shared nodes of |q_i - d_i| - |q_i| - |d_i|
+	distances := map[uint]float64{}
+	for node, count := range query {
+		w := vt.weight(node)
+		if w == 0 {
+			continue
+		}
+		q := count * w / queryNorm
+		for id, imageCount := range vt.invertedFiles[node] {
+			d := imageCount * w / vt.norms[id]
+			if _, ok := distances[id]; !ok {
+				distances[id] = 2
+			}
+			distances[id] += math.Abs(q-d) - q - d
+		}
+	}
+
+	matches := make([]VocabularyTreeMatch, 0, len(distances))
+	for id, distance := range distances {
+		matches = append(matches, VocabularyTreeMatch{ImageID: id, Distance: distance})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].ImageID < matches[j].ImageID
+	})
+	if numResults > 0 && len(matches) > numResults {
+		matches = matches[:numResults]
+	}
+	return matches
+}
@@ -0,0 +1,85 @@
+package vlfeat
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func newTestVocabularyTree() VocabularyTree {
+	return VocabularyTree{
+		K:             3,
+		depth:         2,
+		invertedFiles: map[uint64]map[uint]float64{},
+		images:        map[uint]map[uint64]float64{},
+		norms:         map[uint]float64{},
+	}
+}
+
+func TestVocabularyTreePathCounts(t *testing.T) {
+	vt := newTestVocabularyTree()
+	// leaves (0, 2) and (2, 1) and (0, 2) again
+	counts := vt.pathCounts([]uint{0, 2, 2, 1, 0, 2}, 3)
+	want := map[uint64]float64{1: 2, 6: 2, 3: 1, 11: 1}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("counts = %v, want %v", counts, want)
+	}
+}
+
+// bruteForceDistance is the L1 distance of the normalized weighted node vectors, nodes
+// without images weighing 0
+func bruteForceDistance(vt *VocabularyTree, query, image map[uint64]float64) float64 {
+	normalize := func(counts map[uint64]float64) map[uint64]float64 {
+		weighted, norm := map[uint64]float64{}, 0.0
+		for node, count := range counts {
+			weighted[node] = count * vt.weight(node)
+			norm += weighted[node]
+		}
+		for node := range weighted {
+			weighted[node] /= norm
+		}
+		return weighted
+	}
+	q, d := normalize(query), normalize(image)
+	distance := 0.0
+	for node := range vt.invertedFiles {
+		distance += math.Abs(q[node] - d[node])
+	}
+	return distance
+}
+
+func TestVocabularyTreeQuery(t *testing.T) {
+	vt := newTestVocabularyTree()
+	paths := map[uint][]uint{
+		1: {0, 0, 0, 1, 1, 2},
+		2: {0, 0, 2, 2},
+		3: {1, 0, 1, 1, 1, 2},
+		4: {2, 2, 2, 0},
+	}
+	for id, path := range paths {
+		vt.addCounts(id, vt.pathCounts(path, uint(len(path))/2))
+	}
+	query := vt.pathCounts([]uint{0, 0, 1, 1, 1, 2}, 3)
+	matches := vt.query(query, 0)
+	if len(matches) == 0 || matches[0].ImageID != 3 {
+		t.Fatalf("matches = %v, want image 3 first", matches)
+	}
+	for i, match := range matches {
+		want := bruteForceDistance(&vt, query, vt.images[match.ImageID])
+		if math.Abs(match.Distance-want) > 1e-12 {
+			t.Errorf("image %d: distance %g, want %g", match.ImageID, match.Distance, want)
+		}
+		if i > 0 && match.Distance < matches[i-1].Distance {
+			t.Errorf("matches are not sorted: %v", matches)
+		}
+	}
+
+	if !vt.RemoveImage(3) || vt.RemoveImage(3) {
+		t.Error("RemoveImage should succeed once")
+	}
+	for _, match := range vt.query(query, 0) {
+		if match.ImageID == 3 {
+			t.Error("removed image 3 is still returned")
+		}
+	}
+}